@@ -0,0 +1,9 @@
+package dtos
+
+// RegisterRequest is what a visitor may set when signing up. Role, activation
+// and two-factor settings are decided by the server.
+type RegisterRequest struct {
+    Username string `json:"username" binding:"required,min=3,max=30"`
+    Email    string `json:"email" binding:"omitempty,email"`
+    Password string `json:"password" binding:"required,min=6"`
+}
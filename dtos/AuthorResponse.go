@@ -0,0 +1,12 @@
+package dtos
+
+import (
+	"shop-account/models"
+)
+
+// AuthorDetailResponse is an author with every book they contributed to,
+// grouped by role. Books still lists the books they are the primary author of.
+type AuthorDetailResponse struct {
+	models.Author
+	BooksByRole map[models.ContributorRole][]BookResponse `json:"books_by_role"`
+}
@@ -6,12 +6,46 @@ import (
 
 type BookResponse struct {
 	ID              uint              `json:"id"`
+	Code            string            `json:"code"`
 	Title           string            `json:"title"`
 	Description     string            `json:"description"`
+	ISBN            string            `json:"isbn"`
+	ISBN10          string            `json:"isbn10"`
+	Publisher       *models.Publisher `json:"publisher"`
+	PublishedAt     *models.Date      `json:"published_at"`
+	PageCount       uint              `json:"page_count"`
+	Language        string            `json:"language"`
+	Format          models.BookFormat `json:"format"`
+	Edition         string            `json:"edition"`
 	Price           float64           `json:"price"`
+	CoverURL        string            `json:"cover_url"`
+	CoverVariants   *models.ResponsiveImage `json:"cover_variants,omitempty"`
+	Images          []models.BookImage `json:"images,omitempty"`
+	Contributors    []ContributorResponse `json:"contributors"`
+	// Author is the primary author, kept for clients that predate contributors.
 	Author          models.Author     `json:"author"`
 	Categories      []models.Category `json:"categories"`
 	IsFavorite      bool              `json:"is_favorite"`
 	IdFavorite      uint              `json:"id_favorite"`
 	QuantityInStock uint              `json:"quantity_in_stock"`
+	AverageRating   float64           `json:"average_rating"`
+	ReviewCount     uint              `json:"review_count"`
+}
+
+// ContributorResponse is one contributor of a book, in display order.
+type ContributorResponse struct {
+	AuthorID uint                   `json:"author_id"`
+	Code     string                 `json:"code"`
+	Name     string                 `json:"name"`
+	Role     models.ContributorRole `json:"role"`
+	Position int                    `json:"position"`
+}
+
+// BookSearchResult is a book returned by /books/search with its relevance and
+// highlighted fragments: HTML-escaped text with the matches wrapped in <mark>.
+type BookSearchResult struct {
+	BookResponse
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
 }
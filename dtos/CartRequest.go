@@ -0,0 +1,10 @@
+package dtos
+
+type CartItemRequest struct {
+    BookID   uint `json:"book_id" binding:"required"`
+    Quantity uint `json:"quantity" binding:"required"`
+}
+
+type CartItemQuantityRequest struct {
+    Quantity uint `json:"quantity" binding:"required"`
+}
@@ -0,0 +1,22 @@
+package dtos
+
+type CartItemResponse struct {
+    ID              uint    `json:"id"`
+    BookID          uint    `json:"book_id"`
+    Title           string  `json:"title"`
+    Code            string  `json:"code"`
+    Quantity        uint    `json:"quantity"`
+    UnitPrice       float64 `json:"unit_price"`
+    LineTotal       float64 `json:"line_total"`
+    QuantityInStock uint    `json:"quantity_in_stock"`
+    Available       bool    `json:"available"`
+    Warning         string  `json:"warning,omitempty"`
+}
+
+type CartResponse struct {
+    ID          uint               `json:"id"`
+    Items       []CartItemResponse `json:"items"`
+    TotalItems  uint               `json:"total_items"`
+    TotalAmount float64            `json:"total_amount"`
+    HasWarnings bool               `json:"has_warnings"`
+}
@@ -3,4 +3,12 @@ package dtos
 type CategoryRequest struct {
 	Name        string `form:"name"`
 	Description string `form:"description"`
-}
\ No newline at end of file
+	// ParentID moves the category: 0 to the top level, nil to keep it where it is.
+	ParentID *uint `form:"parent_id" json:"parent_id"`
+}
+
+// MoveCategoryRequest places a category under ParentID, or at the top level
+// when it is null.
+type MoveCategoryRequest struct {
+	ParentID *uint `json:"parent_id"`
+}
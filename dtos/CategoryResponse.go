@@ -0,0 +1,11 @@
+package dtos
+
+import (
+	"shop-account/models"
+)
+
+// CategoryNode is a category with its subcategories, for the category tree.
+type CategoryNode struct {
+	models.Category
+	Children []CategoryNode `json:"children"`
+}
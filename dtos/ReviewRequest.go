@@ -0,0 +1,12 @@
+package dtos
+
+type ReviewRequest struct {
+    Rating int    `json:"rating" binding:"required,min=1,max=5"`
+    Title  string `json:"title" binding:"max=200"`
+    Body   string `json:"body" binding:"max=5000"`
+}
+
+type ReviewReportRequest struct {
+    Reason  string `json:"reason" binding:"required,oneof=spam offensive off_topic fake other"`
+    Details string `json:"details" binding:"max=1000"`
+}
@@ -0,0 +1,16 @@
+package dtos
+
+import "time"
+
+type ReviewResponse struct {
+	ID        uint      `json:"id"`
+	BookID    uint      `json:"book_id"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Rating    int       `json:"rating"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
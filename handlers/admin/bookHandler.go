@@ -0,0 +1,202 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"shop-account/models"
+	"shop-account/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type AdminBookHandler struct {
+	DB *gorm.DB
+}
+
+// importFormat picks the format of an import from the format parameter, the
+// file extension or the content type, in that order.
+func importFormat(format, fileName, contentType string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return "csv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return "csv"
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return "jsonl"
+	}
+	return ""
+}
+
+// readImportFile reads the uploaded "file" field, or the raw request body
+// when the request is not a multipart form.
+func readImportFile(c *gin.Context) (data []byte, fileName, contentType string, err error) {
+	limit := utils.BookImportMaxBytes()
+	var reader io.Reader
+	fileHeader, err := c.FormFile("file")
+	switch {
+	case err == nil:
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, "", "", err
+		}
+		defer file.Close()
+		reader, fileName, contentType = file, fileHeader.Filename, fileHeader.Header.Get("Content-Type")
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+		reader, contentType = c.Request.Body, c.ContentType()
+	default:
+		return nil, "", "", err
+	}
+
+	data, err = io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if int64(len(data)) > limit {
+		return nil, "", "", fmt.Errorf("import files are limited to %d bytes", limit)
+	}
+	if len(data) == 0 {
+		return nil, "", "", errors.New("import file is empty")
+	}
+	return data, fileName, contentType, nil
+}
+
+// ImportBooks imports books from a CSV or JSON Lines file, sent as the
+// "file" field of a multipart form or as the request body. Parameters:
+//
+//	format=csv|jsonl  when it cannot be told from the file name or content type
+//	dry_run=true      validate every row and report what would change, saving nothing
+//	upsert=false      report rows matching an existing book instead of updating it
+//	async=true        run as a background job even for small files
+//
+// Files with more than BOOK_IMPORT_SYNC_LIMIT rows always run in the
+// background; the response is then 202 with the job to poll.
+func (h *AdminBookHandler) ImportBooks(c *gin.Context) {
+	data, fileName, contentType, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import file", "details": err.Error()})
+		return
+	}
+
+	format := importFormat(c.Query("format"), fileName, contentType)
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown import format, pass format=csv or format=jsonl"})
+		return
+	}
+	rows, rowErrors, err := utils.ParseBookImport(bytes.NewReader(data), format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import file", "details": err.Error()})
+		return
+	}
+
+	actorID, actorUsername := currentActor(c)
+	options := utils.BookImportOptions{
+		DryRun: c.Query("dry_run") == "true",
+		Upsert: c.DefaultQuery("upsert", "true") != "false",
+		Actor:  utils.StockMovementRef{ActorID: actorID, ActorUsername: actorUsername},
+	}
+
+	if c.Query("async") == "true" || len(rows) > utils.BookImportSyncLimit() {
+		job := models.ImportJob{
+			Kind:      "books",
+			Status:    models.ImportQueued,
+			DryRun:    options.DryRun,
+			FileName:  fileName,
+			TotalRows: len(rows),
+			ActorID:   actorID,
+		}
+		if err := h.DB.Create(&job).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create import job"})
+			return
+		}
+		utils.StartBookImportJob(h.DB, job, rows, rowErrors, options)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    "Import started",
+			"job":        job,
+			"status_url": fmt.Sprintf("/admin/books/import/%d", job.ID),
+		})
+		return
+	}
+
+	report, err := utils.RunBookImport(h.DB, rows, options, nil)
+	utils.MergeImportErrors(&report, rowErrors)
+	if err != nil {
+		fmt.Printf("Book import failed: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import stopped before the end of the file", "details": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// GetImportJob returns the progress of a background import, and its report
+// once it has finished.
+func (h *AdminBookHandler) GetImportJob(c *gin.Context) {
+	var job models.ImportJob
+	if err := h.DB.Where("kind = ?", "books").First(&job, c.Param("job_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+		return
+	}
+
+	var report *utils.BookImportReport
+	if job.Report != "" {
+		report = &utils.BookImportReport{}
+		if err := json.Unmarshal([]byte(job.Report), report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read import report"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job, "report": report})
+}
+
+// ExportBooks streams the catalog as format=csv (default), jsonl or xlsx. It
+// accepts the filters, search and sort of the book list; rows are written as
+// they are read, so large catalogs are not buffered.
+func (h *AdminBookHandler) ExportBooks(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	contentType, ok := utils.BookExportFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, jsonl or xlsx"})
+		return
+	}
+
+	filter, err := utils.ParseBookFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query, err := utils.ListQuery(c, filter.Apply(h.DB, ""), &models.Book{})
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to export books", "details": err.Error()})
+		return
+	}
+
+	fileName := fmt.Sprintf("books-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Status(http.StatusOK)
+
+	// The status line is already sent, so a failure can only cut the file short.
+	if count, err := utils.ExportBooks(query, format, c.Writer); err != nil {
+		fmt.Printf("Book export failed after %d rows: %v\n", count, err)
+		c.Abort()
+	}
+}
@@ -0,0 +1,198 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"shop-account/models"
+	"shop-account/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type AdminInventoryHandler struct {
+	DB *gorm.DB
+}
+
+// stockDrift is one row of the reconciliation report.
+type stockDrift struct {
+	BookID               uint   `json:"book_id"`
+	Code                 string `json:"code"`
+	Title                string `json:"title"`
+	QuantityInStock      int64  `json:"quantity_in_stock"`
+	LedgerStock          int64  `json:"ledger_stock"`
+	StockDrift           int64  `json:"stock_drift"`
+	QuantitySold         int64  `json:"quantity_sold"`
+	ExpectedQuantitySold int64  `json:"expected_quantity_sold"`
+	SoldDrift            int64  `json:"sold_drift"`
+}
+
+func (d stockDrift) drifted() bool {
+	return d.StockDrift != 0 || d.SoldDrift != 0
+}
+
+// ReconcileStock checks every book's counters against the order data and the
+// ledger: QuantityInStock against the sum of its stock movements, and
+// QuantitySold against the quantities of its live order lines (purchases of
+// transactions that were not rejected, cancelled or deleted). It reports the
+// books where either differs. Pass ?all=true to list every book.
+func (h *AdminInventoryHandler) ReconcileStock(c *gin.Context) {
+	var rows []stockDrift
+	err := h.DB.Raw(`
+		SELECT books.id AS book_id, books.code, books.title, books.quantity_in_stock, books.quantity_sold,
+			COALESCE(ledger.stock, 0) AS ledger_stock,
+			books.quantity_in_stock - COALESCE(ledger.stock, 0) AS stock_drift,
+			COALESCE(sold.quantity, 0) AS expected_quantity_sold,
+			books.quantity_sold - COALESCE(sold.quantity, 0) AS sold_drift
+		FROM books
+		LEFT JOIN (
+			SELECT book_id, SUM(quantity_delta) AS stock
+			FROM stock_movements
+			WHERE deleted_at IS NULL
+			GROUP BY book_id
+		) ledger ON ledger.book_id = books.id
+		LEFT JOIN (
+			SELECT purchases.book_id, SUM(purchases.quantity) AS quantity
+			FROM purchases
+			JOIN transactions ON transactions.id = purchases.transaction_id
+			WHERE purchases.deleted_at IS NULL
+				AND transactions.deleted_at IS NULL
+				AND transactions.status NOT IN (?, ?)
+			GROUP BY purchases.book_id
+		) sold ON sold.book_id = books.id
+		ORDER BY books.id`, models.Rejected, models.Cancelled).Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile stock", "details": err.Error()})
+		return
+	}
+
+	showAll := c.DefaultQuery("all", "false") == "true"
+	report := []stockDrift{}
+	for _, row := range rows {
+		if showAll || row.drifted() {
+			report = append(report, row)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"books_checked": len(rows),
+		"drift_count":   countDrift(rows),
+		"books":         report,
+	})
+}
+
+func countDrift(rows []stockDrift) int {
+	count := 0
+	for _, row := range rows {
+		if row.drifted() {
+			count++
+		}
+	}
+	return count
+}
+
+// ListStockMovements returns the ledger entries of one book, newest first.
+func (h *AdminInventoryHandler) ListStockMovements(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+
+	var book models.Book
+	if err := h.DB.Unscoped().First(&book, bookID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	var movements []models.StockMovement
+	query := h.DB.Where("book_id = ?", book.ID).Order("created_at DESC, id DESC")
+	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, query, &models.StockMovement{}, &movements, nil)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch stock movements", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":           book.ID,
+		"quantity_in_stock": book.QuantityInStock,
+		"current_page":      page,
+		"total_pages":       totalPages,
+		"total_items":       totalItems,
+		"items_per_page":    c.DefaultQuery("limit", "10"),
+		"movements":         movements,
+	})
+}
+
+// CreateStockMovement posts a manual receipt or adjustment for a book. Sales,
+// returns and cancellations are only ever posted by the order flow.
+func (h *AdminInventoryHandler) CreateStockMovement(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+
+	var request struct {
+		Type          models.StockMovementType `json:"type" binding:"required"`
+		QuantityDelta int                      `json:"quantity_delta" binding:"required"`
+		Reference     string                   `json:"reference"`
+		Reason        string                   `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	switch request.Type {
+	case models.MovementReceipt:
+		if request.QuantityDelta < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A receipt must have a positive quantity_delta"})
+			return
+		}
+	case models.MovementAdjustment:
+		if strings.TrimSpace(request.Reason) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required for manual adjustments"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Only %s and %s movements can be posted manually", models.MovementReceipt, models.MovementAdjustment)})
+		return
+	}
+
+	var book models.Book
+	if err := h.DB.First(&book, bookID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	actorID, actorUsername := currentActor(c)
+	ref := utils.StockMovementRef{
+		Reference:     request.Reference,
+		ActorID:       actorID,
+		ActorUsername: actorUsername,
+		Reason:        request.Reason,
+	}
+
+	var movement models.StockMovement
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		movement, err = utils.AdjustStock(tx, book.ID, request.QuantityDelta, request.Type, ref)
+		return err
+	})
+	if stockErr, ok := err.(*utils.StockError); ok {
+		c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error(), "quantity_in_stock": stockErr.Available})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post stock movement", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Stock movement posted successfully",
+		"movement": movement,
+	})
+}
@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"net/http"
+	"shop-account/models"
+	"shop-account/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type AdminReviewHandler struct {
+	DB *gorm.DB
+}
+
+// GetModerationQueue lists reviews for moderators, by default the pending
+// ones, most reported and then oldest first. status=all lists every review;
+// the usual pagination, filter and sort parameters apply.
+func (h *AdminReviewHandler) GetModerationQueue(c *gin.Context) {
+	var reviews []models.Review
+
+	query := h.DB.Preload("User").Preload("Book").Order("reviews.report_count DESC, reviews.created_at ASC")
+	status := models.ReviewStatus(c.DefaultQuery("status", string(models.ReviewPending)))
+	if status != "all" {
+		if !status.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		query = query.Where("reviews.status = ?", status)
+	}
+
+	response, err := utils.PaginateList(c, query, &models.Review{}, &reviews)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch reviews", "details": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(reviews))
+	for _, review := range reviews {
+		items = append(items, gin.H{
+			"review":     review,
+			"username":   review.User.Username,
+			"book_title": review.Book.Title,
+		})
+	}
+
+	response["reviews"] = items
+	c.JSON(http.StatusOK, response)
+}
+
+// GetReview returns a review with its reports and moderation history.
+func (h *AdminReviewHandler) GetReview(c *gin.Context) {
+	var review models.Review
+	if err := h.DB.Preload("User").Preload("Book").First(&review, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	var reports []models.ReviewReport
+	if err := h.DB.Where("review_id = ?", review.ID).Order("created_at ASC").Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+		return
+	}
+
+	var history []models.ReviewModerationLog
+	if err := h.DB.Where("review_id = ?", review.ID).Order("created_at ASC, id ASC").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review":     review,
+		"username":   review.User.Username,
+		"book_title": review.Book.Title,
+		"reports":    reports,
+		"history":    history,
+	})
+}
+
+// UpdateReviewStatus approves, rejects or hides a review (or sends it back
+// to the queue), updating the book rating and the moderation history.
+func (h *AdminReviewHandler) UpdateReviewStatus(c *gin.Context) {
+	var requestBody struct {
+		Status models.ReviewStatus `json:"status"`
+		Reason string              `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if !requestBody.Status.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	actorID, actorUsername := currentActor(c)
+
+	var review models.Review
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&review, c.Param("id")).Error; err != nil {
+			return err
+		}
+		return utils.ChangeReviewStatus(tx, &review, requestBody.Status, actorID, actorUsername, requestBody.Reason)
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Review status updated successfully",
+		"review":  review,
+	})
+}
@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"shop-account/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type AdminRoleHandler struct {
+	DB *gorm.DB
+}
+
+// GetRoles lists every role with its permissions.
+func (h *AdminRoleHandler) GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := h.DB.Preload("Permissions").Order("name ASC").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GetPermissions lists every permission that can be granted to a role.
+func (h *AdminRoleHandler) GetPermissions(c *gin.Context) {
+	var permissions []models.Permission
+	if err := h.DB.Order("name ASC").Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// findPermissions resolves permission names, failing on unknown ones.
+func (h *AdminRoleHandler) findPermissions(names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	if err := h.DB.Where("name IN (?)", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	if len(permissions) != len(names) {
+		found := map[string]bool{}
+		for _, permission := range permissions {
+			found[permission.Name] = true
+		}
+		var unknown []string
+		for _, name := range names {
+			if !found[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		return nil, fmt.Errorf("unknown permissions: %s", strings.Join(unknown, ", "))
+	}
+	return permissions, nil
+}
+
+// CreateRole creates a role with the given permissions.
+func (h *AdminRoleHandler) CreateRole(c *gin.Context) {
+	var request struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	var existing models.Role
+	if err := h.DB.Where("name = ?", request.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	permissions, err := h.findPermissions(request.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.Role{Name: request.Name, Description: request.Description, Permissions: permissions}
+	if err := h.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Role created successfully", "role": role})
+}
+
+// UpdateRolePermissions replaces the permissions of a role. The admin role
+// always keeps every permission.
+func (h *AdminRoleHandler) UpdateRolePermissions(c *gin.Context) {
+	var role models.Role
+	if err := h.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.Name == "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The admin role always has every permission"})
+		return
+	}
+
+	var request struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	permissions, err := h.findPermissions(request.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Model(&role).Association("Permissions").Replace(permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+		return
+	}
+	role.Permissions = permissions
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role permissions updated successfully", "role": role})
+}
@@ -17,22 +17,35 @@ func (h *AdminTransactionHandler) GetAllTransactions(c *gin.Context) {
 	var transactions []models.Transaction
 
 	// Get pagination and search parameters from the query string
-	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, h.DB.Preload("User").Preload("Purchases"), &models.Transaction{}, &transactions, nil)
+	response, err := utils.PaginateList(c, h.DB.Preload("User").Preload("Purchases"), &models.Transaction{}, &transactions)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions", "details": err.Error()})
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch transactions", "details": err.Error()})
 		return
 	}
 
 	// Return the paginated transactions along with metadata
-	c.JSON(http.StatusOK, gin.H{
-		"current_page":   page,
-		"total_pages":    totalPages,
-		"total_items":    totalItems,
-		"items_per_page": c.DefaultQuery("limit", "10"),
-		"transactions":   transactions,
-	})
+	response["transactions"] = transactions
+	c.JSON(http.StatusOK, response)
 }
 
+// GetTransactionByCode looks a transaction up by its code, e.g. TST261018000420.
+func (h *AdminTransactionHandler) GetTransactionByCode(c *gin.Context) {
+	var transaction models.Transaction
+	if err := h.DB.Preload("User").Preload("Purchases").Where("code = ?", c.Param("code")).First(&transaction).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transaction"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction": transaction})
+}
+
+// UpdateTransactionStatus moves a transaction to a new status, enforcing the
+// transition table in models and recording the change in the status history.
+// Rejecting or cancelling an order gives its stock back.
 func (h *AdminTransactionHandler) UpdateTransactionStatus(c *gin.Context) {
 	transactionID := c.Param("id")
 	if transactionID == "" {
@@ -42,42 +55,43 @@ func (h *AdminTransactionHandler) UpdateTransactionStatus(c *gin.Context) {
 
 	var requestBody struct {
 		Status models.TransactionStatus `json:"status"`
+		Reason string                   `json:"reason"`
 	}
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
 
-	validStatuses := []models.TransactionStatus{
-		models.Pending,
-		models.Approved,
-		models.Rejected,
-		models.Completed,
-	}
-
-	isValidStatus := false
-	for _, validStatus := range validStatuses {
-		if requestBody.Status == validStatus {
-			isValidStatus = true
-			break
-		}
-	}
-
-	if !isValidStatus {
+	if !requestBody.Status.IsValid() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
 		return
 	}
 
-	// Find the transaction by ID
+	actorID, actorUsername := currentActor(c)
+
 	var transaction models.Transaction
-	if err := h.DB.First(&transaction, transactionID).Error; err != nil {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so two admins cannot both move the same order from
+		// the same status.
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&transaction, transactionID).Error; err != nil {
+			return err
+		}
+
+		return utils.ChangeTransactionStatus(tx, &transaction, requestBody.Status, actorID, actorUsername, requestBody.Reason)
+	})
+	if gorm.IsRecordNotFoundError(err) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
-
-	// Update the status of the transaction
-	transaction.Status = requestBody.Status
-	if err := h.DB.Save(&transaction).Error; err != nil {
+	if transitionErr, ok := err.(*models.TransitionError); ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":            transitionErr.Error(),
+			"current_status":   transitionErr.From,
+			"allowed_statuses": transitionErr.From.NextStatuses(),
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction status"})
 		return
 	}
@@ -87,3 +101,15 @@ func (h *AdminTransactionHandler) UpdateTransactionStatus(c *gin.Context) {
 		"transaction": transaction,
 	})
 }
+
+// currentActor returns the ID and username of the authenticated user making
+// the request, as stored in the context by the auth middleware.
+func currentActor(c *gin.Context) (uint, string) {
+	var actorID uint
+	if userID, ok := c.Get("user_id"); ok {
+		if userIDFloat, ok := userID.(float64); ok {
+			actorID = uint(userIDFloat)
+		}
+	}
+	return actorID, c.GetString("username")
+}
@@ -2,15 +2,16 @@ package handlers
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"shop-account/dtos"
 	"shop-account/models"
 	"shop-account/utils"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"github.com/jinzhu/gorm"
-	"time"
-	"github.com/dgrijalva/jwt-go"
-	"strings"
-	"errors" 
 )
 
 // AuthHandler struct with DB field
@@ -19,13 +20,14 @@ type AuthHandler struct {
 }
 // Register handler for user registration
 func (h *AuthHandler) Register(c *gin.Context) {
-	var user models.User
+	var request dtos.RegisterRequest
 
-	// Bind JSON input to user model
-	if err := c.ShouldBindJSON(&user); err != nil {
+	// Bind JSON input to the register request
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
+	user := models.User{Username: request.Username, Email: request.Email, Password: request.Password}
 
 	// Check if the username already exists
 	var existingUser models.User
@@ -55,14 +57,202 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	// Set default role for the new user
 	user.Role = "guest" // Default role, can be changed based on your application's logic
 
+	// The account stays inactive until the email is verified (or an admin
+	// activates it), whatever the request body says.
+	user.Active = false
+	user.EmailVerifiedAt = nil
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+	if user.Email != "" {
+		var emailCount int
+		if err := h.DB.Model(&models.User{}).Where("LOWER(email) = ?", user.Email).Count(&emailCount).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error while checking email"})
+			return
+		}
+		if emailCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+	}
+
+	code, err := utils.GenerateCode(h.DB, &models.User{})
+	if err != nil {
+		fmt.Printf("Error generating user code: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate user code"})
+		return
+	}
+	user.Code = code
+
 	// Save the user to the database
 	if err := h.DB.Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
 	}
 
+	if user.Email == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(user); err != nil {
+		fmt.Printf("Error sending verification email to user %d: %v\n", user.ID, err)
+		c.JSON(http.StatusOK, gin.H{"message": "User registered successfully, but the verification email could not be sent"})
+		return
+	}
+
 	// Return success message
-	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully, check your email to activate the account"})
+}
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+// appURL builds a link to the storefront from APP_BASE_URL.
+func appURL(path string, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(os.Getenv("APP_BASE_URL"), "/"), path, url.QueryEscape(token))
+}
+
+func (h *AuthHandler) sendVerificationEmail(user models.User) error {
+	token, err := utils.IssueUserToken(h.DB, user.ID, models.EmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return utils.Mail.Send(utils.MailMessage{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below within %s to verify your email and activate your account:\n\n%s\n",
+			user.Username, emailVerificationTTL, appURL("/verify-email", token)),
+	})
+}
+
+// VerifyEmail consumes an email verification token and activates the account.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := utils.ConsumeUserToken(tx, request.Token, models.EmailVerification)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", record.UserID).UpdateColumns(map[string]interface{}{
+			"active":            true,
+			"email_verified_at": time.Now(),
+		}).Error
+	})
+	if err == utils.ErrUserTokenInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified, the account is now active"})
+}
+
+// ResendVerification mails a new verification link. It answers the same way
+// whether or not the address is known, so it cannot be used to probe for
+// accounts.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var user models.User
+	err := h.DB.Where("LOWER(email) = ? AND email_verified_at IS NULL", strings.ToLower(strings.TrimSpace(request.Email))).First(&user).Error
+	if err == nil {
+		if err := h.sendVerificationEmail(user); err != nil {
+			fmt.Printf("Error sending verification email to user %d: %v\n", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an unverified account, a verification email has been sent"})
+}
+
+// ForgotPassword mails a password reset link. Like ResendVerification it does
+// not reveal whether the address is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var user models.User
+	err := h.DB.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(request.Email))).First(&user).Error
+	if err == nil {
+		token, err := utils.IssueUserToken(h.DB, user.ID, models.PasswordReset, passwordResetTTL)
+		if err == nil {
+			err = utils.Mail.Send(utils.MailMessage{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body: fmt.Sprintf("Hi %s,\n\nOpen the link below within %s to choose a new password:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+					user.Username, passwordResetTTL, appURL("/reset-password", token)),
+			})
+		}
+		if err != nil {
+			fmt.Printf("Error sending password reset email to user %d: %v\n", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address is registered, a password reset email has been sent"})
+}
+
+// ResetPassword consumes a password reset token, sets the new password and
+// logs the user out of every session.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var request struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(request.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var userID uint
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := utils.ConsumeUserToken(tx, request.Token, models.PasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = record.UserID
+		return tx.Model(&models.User{}).Where("id = ?", record.UserID).UpdateColumn("password", hashedPassword).Error
+	})
+	if err == utils.ErrUserTokenInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := utils.RevokeAllSessions(h.DB, userID); err != nil {
+		fmt.Printf("Error revoking sessions of user %d after password reset: %v\n", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
 }
 
 // Login handler for user login
@@ -90,80 +280,102 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := generateToken(existingUser.ID, existingUser.Username, existingUser.Role)
+	// With 2FA enabled the password only earns a challenge token, which
+	// /auth/2fa/verify exchanges for a session together with a valid code.
+	if existingUser.TwoFactorEnabled {
+		challenge, expiresIn, err := utils.IssueTwoFactorChallenge(h.DB, existingUser)
+		if err == utils.ErrTwoFactorLocked {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          expiresIn,
+		})
+		return
+	}
+
+	tokens, err := utils.IssueSession(h.DB, existingUser, false, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token":    token,
+		"token":    tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"id":       existingUser.ID,
 		"username": existingUser.Username,
 		// "email":    existingUser.Email,  // Include the email if necessary
 		"role":     existingUser.Role,
 		"active":   existingUser.Active, // Include active status if needed
+		"two_factor_enrollment_required": utils.TwoFactorRequiredFor(&existingUser),
 	})
 }
 
 
-func generateToken(user_id uint, username, role string) (string, error) {
-	secretKey := []byte("your_secret_key")
-	fmt.Printf("user_id in generateToken %d", user_id)
-	// the JWT claims require the value to be of type interface{}
-	//  (which can hold various types), the correct approach would be to convert the uint to float64 
-	// before setting it in the JWT claims. This is because JWT claims often store numbers as float64.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": float64(user_id),
-		"username": username,
-		"role":     role,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
-
-	return token.SignedString(secretKey)
-}
-
-func (h *AuthHandler) ValidateToken(c *gin.Context) (*models.User, error) {
-	// Get the token from the Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		return nil, errors.New("Missing authorization token")
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token can be used once.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
 	}
 
-	// Extract token from the "Bearer <token>" format
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == "" {
-		return nil, errors.New("Invalid authorization format")
+	tokens, err := utils.RotateRefreshToken(h.DB, request.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		switch err {
+		case utils.ErrRefreshTokenInvalid, utils.ErrRefreshTokenExpired, utils.ErrRefreshTokenRevoked, utils.ErrRefreshTokenReused, utils.ErrUserInactive:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		}
+		return
 	}
 
-	// Parse the token
-	secretKey := []byte("your_secret_key")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, errors.New("Invalid token")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the session of the access token used for the request, so
+// neither its access token nor its refresh token work any more.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is not bound to a session"})
+		return
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("Invalid token claims")
+	if err := utils.RevokeSession(h.DB, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
 	}
 
-	// Retrieve username and role from token claims
-	username, ok := claims["username"].(string)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every session of the current user.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, ok := currentUserID(c)
 	if !ok {
-		return nil, errors.New("Invalid username in token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
 	}
 
-	// Retrieve the user from the database
-	var user models.User
-	if err := h.DB.Where("username = ?", username).First(&user).Error; err != nil {
-		return nil, errors.New("User not found")
+	if err := utils.RevokeAllSessions(h.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
 	}
 
-	return &user, nil
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions"})
 }
 
 // UpdateRole handler for admins to change the role of a user
@@ -179,10 +391,12 @@ func (h *AuthHandler) UpdateRole(c *gin.Context) {
 		return
 	}
 	fmt.Printf("Username %s", request.Username)
-	// Validate the JWT token and extract the user
-	currentUser, err := h.ValidateToken(c)
-	if err != nil || currentUser.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admin can change roles"})
+	// The users:admin permission is checked by the route middleware.
+
+	// Only roles that exist can be assigned
+	var role models.Role
+	if err := h.DB.Where("name = ?", request.Role).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
 		return
 	}
 
@@ -217,13 +431,6 @@ func (h *AuthHandler) ActivateUser(c *gin.Context) {
 		return
 	}
 
-	// Validate the JWT token and extract the user (assuming admin role is required)
-	currentUser, err := h.ValidateToken(c)
-	if err != nil || currentUser.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admin can activate users"})
-		return
-	}
-
 	// Retrieve the user from the database
 	var user models.User
 	if err := h.DB.Where("username = ?", request.Username).First(&user).Error; err != nil {
@@ -247,3 +454,39 @@ func (h *AuthHandler) ActivateUser(c *gin.Context) {
 	// Return success message
 	c.JSON(http.StatusOK, gin.H{"message": "User activated successfully"})
 }
+
+// DeactivateUser handler for admins to deactivate a user's account. All of
+// the user's sessions are revoked, so the user is logged out immediately.
+func (h *AuthHandler) DeactivateUser(c *gin.Context) {
+	var request struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Where("username = ?", request.Username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already inactive"})
+		return
+	}
+
+	if err := h.DB.Model(&user).UpdateColumn("active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+		return
+	}
+
+	if err := utils.RevokeAllSessions(h.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke user sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deactivated successfully"})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"shop-account/dtos"
 	"shop-account/models"
 	"shop-account/utils"
 	"github.com/gin-gonic/gin"
@@ -27,7 +28,7 @@ func (h *AuthorHandler) GetAuthors(c *gin.Context) {
 	// Call PaginateAndSearch utility to fetch paginated data with dynamic search (if any)
 	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, query, &models.Author{}, &authors, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch authors", "details": err.Error()})
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch authors", "details": err.Error()})
 		return
 	}
 
@@ -109,7 +110,63 @@ func (h *AuthorHandler) GetAuthorByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, author)
+	h.writeAuthorDetail(c, author)
+}
+
+// Hàm lấy thông tin tác giả theo mã (ví dụ AU0007)
+func (h *AuthorHandler) GetAuthorByCode(c *gin.Context) {
+	var author models.Author
+	if err := h.DB.Preload("Books").Where("code = ?", c.Param("code")).First(&author).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Author not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve author"})
+		}
+		return
+	}
+
+	h.writeAuthorDetail(c, author)
+}
+
+// writeAuthorDetail writes the author with the books they contributed to,
+// grouped by role and newest first within each role.
+func (h *AuthorHandler) writeAuthorDetail(c *gin.Context, author models.Author) {
+	var contributions []models.BookContributor
+	if err := h.DB.Where("author_id = ?", author.ID).Find(&contributions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve author books"})
+		return
+	}
+	bookIDs := make([]uint, 0, len(contributions))
+	for _, contribution := range contributions {
+		bookIDs = append(bookIDs, contribution.BookID)
+	}
+
+	var books []models.Book
+	if len(bookIDs) > 0 {
+		if err := h.DB.Preload("Author").Preload("Categories").Where("id IN (?)", bookIDs).
+			Order("published_at DESC NULLS LAST, id DESC").Find(&books).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve author books"})
+			return
+		}
+	}
+	responses, err := buildBookResponses(h.DB, books, optionalUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve author books"})
+		return
+	}
+
+	roles := map[uint][]models.ContributorRole{}
+	for _, contribution := range contributions {
+		roles[contribution.BookID] = append(roles[contribution.BookID], contribution.Role)
+	}
+	detail := dtos.AuthorDetailResponse{Author: author, BooksByRole: map[models.ContributorRole][]dtos.BookResponse{}}
+	for _, response := range responses {
+		for _, role := range roles[response.ID] {
+			detail.BooksByRole[role] = append(detail.BooksByRole[role], response)
+		}
+	}
+
+	c.JSON(http.StatusOK, detail)
 }
 
 // Hàm cập nhật thông tin tác giả
@@ -132,10 +189,13 @@ func (h *AuthorHandler) UpdateAuthor(c *gin.Context) {
 	}
 
 	// Bind dữ liệu mới từ request body
+	code := author.Code
 	if err := c.ShouldBindJSON(&author); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Mã tác giả không được thay đổi sau khi tạo
+	author.Code = code
 
 	// Kiểm tra nếu name bị bỏ trống
 	if strings.TrimSpace(author.Name) == "" {
@@ -1,16 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"shop-account/dtos"
 	"shop-account/models"
 	"shop-account/utils"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/jinzhu/gorm"
 )
 
@@ -43,97 +43,90 @@ type BookHandler struct {
 // 	})
 // }
 
-func (h *BookHandler) GetBooks(c *gin.Context) {
-	var books []models.Book
-
-	// Query to preload related Author and Categories
-	query := h.DB.Preload("Author").Preload("Categories")
+// bookStockRef builds the ledger reference for stock changes made through the
+// book endpoints, using the optional user ID set by SetUserIDMiddleware.
+func bookStockRef(c *gin.Context, reference string, reason string) utils.StockMovementRef {
+	ref := utils.StockMovementRef{Reference: reference, Reason: reason}
+	if userID, exists := c.Get("id"); exists {
+		if userIDUint, ok := userID.(uint); ok {
+			ref.ActorID = userIDUint
+		}
+	}
+	return ref
+}
 
-	// Paginate and search
-	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, query, &models.Book{}, &books, nil)
+// resolveBookContributors validates the contributors sent with a book,
+// writing the error response when they are rejected. It returns nil when the
+// request has none.
+func resolveBookContributors(c *gin.Context, db *gorm.DB, inputs []utils.ContributorInput) ([]models.BookContributor, bool) {
+	contributors, err := utils.ResolveContributors(db, inputs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books", "details": err.Error()})
-		return
-	}
-
-	// Prepare the response struct for books
-	var bookResponses []dtos.BookResponse
-
-	// Get user ID from context
-	userID, exists := c.Get("id")
-	if !exists {
-		// If userID doesn't exist, we proceed with no favorites info
-		for _, book := range books {
-			bookResponses = append(bookResponses, dtos.BookResponse{
-				ID:          book.ID,
-				Title:       book.Title,
-				Description: book.Description,
-				Price:       book.Price,
-				Author:      book.Author,
-				Categories:  book.Categories,
-				IsFavorite:  false,
-				IdFavorite:  0,
-			})
+		var contributorErr *utils.ContributorError
+		if errors.As(err, &contributorErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": contributorErr.Message})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate contributors"})
 		}
-		c.JSON(http.StatusOK, gin.H{
-			"current_page":   page,
-			"total_pages":    totalPages,
-			"total_items":    totalItems,
-			"items_per_page": c.DefaultQuery("limit", "10"),
-			"books":          bookResponses,
-			"userID":         userID,
-		})
-		return
+		return nil, false
 	}
+	return contributors, true
+}
 
-	userIDUint, ok := userID.(uint)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-		return
+// saveBookContributors stores the contributors of a request, or, when the
+// client only sent author_id, makes that author the primary one.
+func saveBookContributors(tx *gorm.DB, book models.Book, contributors []models.BookContributor) error {
+	if contributors != nil {
+		return utils.SetBookContributors(tx, book.ID, contributors)
 	}
+	return utils.SyncPrimaryAuthor(tx, book.ID, book.AuthorID)
+}
 
-	// Loop through the books and build the response
-	for _, book := range books {
-		var favoriteBook models.FavoriteBook
-		isFavorite := false
-		var favoriteID *uint // Pointer to store favorite book ID
+func (h *BookHandler) GetBooks(c *gin.Context) {
+	var books []models.Book
 
-		// Check if the book is in the user's favorites
-		if err := h.DB.Where("user_id = ? AND book_id = ?", userIDUint, book.ID).First(&favoriteBook).Error; err == nil {
-			isFavorite = true
-			favoriteID = &favoriteBook.ID // Assign the favorite book's ID if found
-		}
+	filter, err := utils.ParseBookFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Safely dereference favoriteID if it's not nil
-		var favoriteIDValue uint
-		if favoriteID != nil {
-			favoriteIDValue = *favoriteID // Dereference to get the actual ID
-		}
+	// Query to preload related Author and Categories; the sort parameter is
+	// applied by PaginateList.
+	query := filter.Apply(h.DB.Preload("Author").Preload("Categories"), "")
+
+	// Paginate and search, in offset or cursor mode
+	response, err := utils.PaginateList(c, query, &models.Book{}, &books)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch books", "details": err.Error()})
+		return
+	}
 
-		// Build the book response
-		bookResponse := dtos.BookResponse{
-			ID:          book.ID,
-			Title:       book.Title,
-			Description: book.Description,
-			Price:       book.Price,
-			Author:      book.Author,
-			Categories:  book.Categories,
-			IsFavorite:  isFavorite,
-			IdFavorite:  favoriteIDValue, // Set the ID of the favorite (or 0 if not found)
+	var facets *utils.BookFacets
+	if c.DefaultQuery("facets", "true") != "false" {
+		schema, _ := utils.SchemaFor(&models.Book{})
+		computed, err := utils.ComputeBookFacets(h.DB, filter, schema.FilterScope(c.Request.URL.Query()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute facets", "details": err.Error()})
+			return
 		}
+		facets = &computed
+	}
 
-		bookResponses = append(bookResponses, bookResponse)
+	bookResponses, err := buildBookResponses(h.DB, books, optionalUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load favorites", "details": err.Error()})
+		return
 	}
 
 	// Return the response with books and pagination info
-	c.JSON(http.StatusOK, gin.H{
-		"current_page":   page,
-		"total_pages":    totalPages,
-		"total_items":    totalItems,
-		"items_per_page": c.DefaultQuery("limit", "10"),
-		"books":          bookResponses,
-		"userID":         userID,
-	})
+	response["books"] = bookResponses
+	response["facets"] = facets
+	if userID, exists := c.Get("id"); exists {
+		response["userID"] = userID
+	} else {
+		response["userID"] = nil
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *BookHandler) CreateBook(c *gin.Context) {
@@ -144,6 +137,10 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		Description     string `json:"description"`
 		AuthorID        uint   `json:"author_id"`
 		CategoryIDs     []uint `json:"categories"`
+		// Contributors replace the book's contributors; the first author
+		// becomes author_id, which is then optional.
+		Contributors    []utils.ContributorInput `json:"contributors"`
+		bookMetadata
 	}
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
@@ -159,6 +156,14 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		return
 	}
 
+	contributors, ok := resolveBookContributors(c, h.DB, requestData.Contributors)
+	if !ok {
+		return
+	}
+	if contributors != nil {
+		requestData.AuthorID = utils.PrimaryAuthorID(contributors)
+	}
+
 	var author models.Author
 	if err := h.DB.First(&author, requestData.AuthorID).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -169,22 +174,27 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		return
 	}
 
-	code, err := utils.GenerateCode(h.DB, &models.Book{})
-	if err != nil {
-		fmt.Printf("Error generating book code: %s\n", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate book code: %s", err.Error())})
-		return
-	}
-
 	book := models.Book{
 		Title:           requestData.Title,
 		Description:     requestData.Description,
 		AuthorID:        requestData.AuthorID,
 		Price:           float64(requestData.Price),
 		QuantityInStock: requestData.QuantityInStock,
-		Code:            code,
 		Active:          true,
 	}
+	if err := requestData.bookMetadata.apply(h.DB, &book); err != nil {
+		status, errMsg := metadataErrorResponse(err)
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+
+	code, err := utils.GenerateCode(h.DB, &models.Book{})
+	if err != nil {
+		fmt.Printf("Error generating book code: %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate book code: %s", err.Error())})
+		return
+	}
+	book.Code = code
 
 	if len(requestData.CategoryIDs) > 0 {
 		var categories []models.Category
@@ -202,7 +212,16 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Preload("Author").Preload("Categories").Create(&book).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&book).Error; err != nil {
+			return err
+		}
+		if err := saveBookContributors(tx, book, contributors); err != nil {
+			return err
+		}
+		return utils.RecordOpeningStock(tx, book.ID, bookStockRef(c, book.Code, "initial stock"))
+	})
+	if err != nil {
 		fmt.Printf("Error creating book in DB: %s\n", err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create book in DB: %s", err.Error())})
 		return
@@ -229,41 +248,61 @@ func (h *BookHandler) GetBookByID(c *gin.Context) {
 		return
 	}
 
-	// Retrieve userID from context
-	userID, exists := c.Get("id")
-	var isFavorite bool
-	var favoriteID uint // This will hold the favorite book ID
+	h.writeBookDetail(c, book)
+}
 
-	if exists {
-		userIDUint, ok := userID.(uint)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID type"})
-			return
+// GetBookByCode looks a book up by its code, e.g. /books/code/BO0042.
+func (h *BookHandler) GetBookByCode(c *gin.Context) {
+	var book models.Book
+	if err := h.DB.Preload("Author").Preload("Categories").Where("code = ?", c.Param("code")).First(&book).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve book"})
 		}
+		return
+	}
+
+	h.writeBookDetail(c, book)
+}
+
+// GetBookByISBN looks a book up by its ISBN-10 or ISBN-13, with or without
+// hyphens, e.g. /books/isbn/978-0-306-40615-7.
+func (h *BookHandler) GetBookByISBN(c *gin.Context) {
+	isbn13, _, err := utils.ParseISBN(c.Param("isbn"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Check if the book is in the user's favorites
-		var favoriteBook models.FavoriteBook
-		if err := h.DB.Where("user_id = ? AND book_id = ?", userIDUint, book.ID).First(&favoriteBook).Error; err == nil {
-			isFavorite = true
-			favoriteID = favoriteBook.ID // Use the ID directly, no need for dereferencing
+	var book models.Book
+	if err := h.DB.Preload("Author").Preload("Publisher").Preload("Categories").Where("isbn = ?", isbn13).First(&book).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve book"})
 		}
+		return
 	}
 
-	// Prepare the response struct
-	bookResponse := dtos.BookResponse{
-		ID:              book.ID,
-		Title:           book.Title,
-		Description:     book.Description,
-		Price:           book.Price,
-		Author:          book.Author,
-		Categories:      book.Categories,
-		IsFavorite:      isFavorite,
-		IdFavorite:      favoriteID,
-		QuantityInStock: book.QuantityInStock,
+	h.writeBookDetail(c, book)
+}
+
+// writeBookDetail writes the detail response of book for the current user.
+func (h *BookHandler) writeBookDetail(c *gin.Context, book models.Book) {
+	if err := h.DB.Where("book_id = ?", book.ID).Order("position ASC, id ASC").Find(&book.Images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load book images"})
+		return
+	}
+
+	responses, err := buildBookResponses(h.DB, []models.Book{book}, optionalUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load favorites"})
+		return
 	}
 
 	// Return the response
-	c.JSON(http.StatusOK, bookResponse)
+	c.JSON(http.StatusOK, responses[0])
 }
 
 func (h *BookHandler) UpdateBook(c *gin.Context) {
@@ -274,6 +313,10 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 		Description     string `json:"description"`
 		AuthorID        uint   `json:"author_id"`
 		CategoryIDs     []uint `json:"categories"`
+		// Contributors replace the book's contributors; the first author
+		// becomes author_id, which is then optional.
+		Contributors    []utils.ContributorInput `json:"contributors"`
+		bookMetadata
 	}
 
 	id := c.Param("id")
@@ -306,6 +349,14 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 		return
 	}
 
+	contributors, ok := resolveBookContributors(c, h.DB, requestData.Contributors)
+	if !ok {
+		return
+	}
+	if contributors != nil {
+		requestData.AuthorID = utils.PrimaryAuthorID(contributors)
+	}
+
 	var author models.Author
 	if err := h.DB.First(&author, requestData.AuthorID).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -316,6 +367,12 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 		return
 	}
 
+	if err := requestData.bookMetadata.apply(h.DB, &book); err != nil {
+		status, errMsg := metadataErrorResponse(err)
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+
 	if err := h.DB.Where("book_id = ?", book.ID).Delete(&models.BookCategory{}).Error; err != nil {
 		fmt.Printf("Error manually clearing categories: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to manually clear categories"})
@@ -325,7 +382,6 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 	book.Title = requestData.Title
 	book.Description = requestData.Description
 	book.Price = float64(requestData.Price)
-	book.QuantityInStock = requestData.QuantityInStock
 	book.AuthorID = requestData.AuthorID
 
 	if len(requestData.CategoryIDs) > 0 {
@@ -359,12 +415,25 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Preload("Author").Preload("Categories").Save(&book).Error; err != nil {
+	// Stock goes through the ledger; the counters are omitted from Save so a
+	// stale read cannot overwrite sales made in the meantime.
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := utils.SetStock(tx, book.ID, requestData.QuantityInStock, bookStockRef(c, book.Code, "stock set by book update")); err != nil {
+			return err
+		}
+		if err := saveBookContributors(tx, book, contributors); err != nil {
+			return err
+		}
+		return tx.Omit("quantity_in_stock", "quantity_sold").Save(&book).Error
+	})
+	if err != nil {
 		fmt.Printf("Error updating book in DB: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
 		return
 	}
 
+	h.DB.Preload("Author").Preload("Publisher").Preload("Categories").First(&book, book.ID)
+
 	c.JSON(http.StatusOK, book)
 }
 
@@ -376,6 +445,11 @@ func (h *BookHandler) DeleteBook(c *gin.Context) {
 		return
 	}
 
+	if c.Query("hard") == "true" {
+		h.hardDeleteBook(c, uint(bookID))
+		return
+	}
+
 	var book models.Book
 	if err := h.DB.First(&book, bookID).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -394,6 +468,77 @@ func (h *BookHandler) DeleteBook(c *gin.Context) {
 	c.JSON(http.StatusNoContent, nil)
 }
 
+var errBookHasOrders = errors.New("book appears in orders and cannot be permanently deleted, deactivate or soft delete it instead")
+
+// hardDeleteBook permanently removes a book (also an already soft-deleted
+// one) with its images, reviews, favorites and cart lines, then deletes its
+// stored files. Books that were ever ordered are kept for the order history.
+func (h *BookHandler) hardDeleteBook(c *gin.Context, bookID uint) {
+	var storedKeys []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var book models.Book
+		if err := tx.Unscoped().Set("gorm:query_option", "FOR UPDATE").First(&book, bookID).Error; err != nil {
+			return err
+		}
+
+		var orders int64
+		if err := tx.Unscoped().Model(&models.Purchase{}).Where("book_id = ?", book.ID).Count(&orders).Error; err != nil {
+			return err
+		}
+		if orders > 0 {
+			return errBookHasOrders
+		}
+
+		var images []models.BookImage
+		if err := tx.Unscoped().Where("book_id = ?", book.ID).Find(&images).Error; err != nil {
+			return err
+		}
+		storedKeys = append(storedKeys, book.CoverKey)
+		for _, image := range images {
+			storedKeys = append(storedKeys, image.StorageKey)
+		}
+
+		steps := []func() error{
+			func() error {
+				return tx.Exec("DELETE FROM review_reports WHERE review_id IN (SELECT id FROM reviews WHERE book_id = ?)", book.ID).Error
+			},
+			func() error {
+				return tx.Exec("DELETE FROM review_moderation_logs WHERE review_id IN (SELECT id FROM reviews WHERE book_id = ?)", book.ID).Error
+			},
+			func() error { return tx.Unscoped().Where("book_id = ?", book.ID).Delete(&models.Review{}).Error },
+			func() error { return tx.Unscoped().Where("book_id = ?", book.ID).Delete(&models.BookImage{}).Error },
+			func() error { return tx.Where("book_id = ?", book.ID).Delete(&models.BookContributor{}).Error },
+			func() error { return tx.Unscoped().Where("book_id = ?", book.ID).Delete(&models.FavoriteBook{}).Error },
+			func() error { return tx.Unscoped().Where("book_id = ?", book.ID).Delete(&models.CartItem{}).Error },
+			func() error { return tx.Unscoped().Where("book_id = ?", book.ID).Delete(&models.StockMovement{}).Error },
+			func() error { return tx.Exec("DELETE FROM book_categories WHERE book_id = ?", book.ID).Error },
+			func() error { return tx.Unscoped().Delete(&book).Error },
+		}
+		for _, step := range steps {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+	if err == errBookHasOrders {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error permanently deleting book %d: %v\n", bookID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+		return
+	}
+	utils.DeleteStoredImages(h.DB, storedKeys...)
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
 func (h *BookHandler) PatchBook(c *gin.Context) {
 	id := c.Param("id")
 	bookID, err := strconv.Atoi(id)
@@ -413,10 +558,29 @@ func (h *BookHandler) PatchBook(c *gin.Context) {
 	}
 
 	var updatedBook models.Book
-	if err := c.ShouldBindJSON(&updatedBook); err != nil {
+	var metadata bookMetadata
+	if err := c.ShouldBindBodyWith(&updatedBook, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if err := c.ShouldBindBodyWith(&metadata, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
 		return
 	}
+	var contributorsRequest struct {
+		Contributors []utils.ContributorInput `json:"contributors"`
+	}
+	if err := c.ShouldBindBodyWith(&contributorsRequest, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	contributors, ok := resolveBookContributors(c, h.DB, contributorsRequest.Contributors)
+	if !ok {
+		return
+	}
+	if contributors != nil {
+		updatedBook.AuthorID = utils.PrimaryAuthorID(contributors)
+	}
 
 	var author models.Author
 	if updatedBook.AuthorID != 0 {
@@ -439,17 +603,33 @@ func (h *BookHandler) PatchBook(c *gin.Context) {
 	if updatedBook.Price != 0 {
 		book.Price = updatedBook.Price
 	}
-	if updatedBook.QuantityInStock != 0 {
-		book.QuantityInStock = updatedBook.QuantityInStock
-	}
 
 	book.Active = updatedBook.Active
 
-	if err := h.DB.Save(&book).Error; err != nil {
+	if err := metadata.apply(h.DB, &book); err != nil {
+		status, errMsg := metadataErrorResponse(err)
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if updatedBook.QuantityInStock != 0 {
+			if err := utils.SetStock(tx, book.ID, updatedBook.QuantityInStock, bookStockRef(c, book.Code, "stock set by book patch")); err != nil {
+				return err
+			}
+		}
+		if err := saveBookContributors(tx, book, contributors); err != nil {
+			return err
+		}
+		return tx.Omit("quantity_in_stock", "quantity_sold").Save(&book).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
 		return
 	}
 
+	h.DB.First(&book, book.ID)
+
 	c.JSON(http.StatusOK, book)
 }
 
@@ -517,43 +697,6 @@ func (h *BookHandler) GetBooksNotConcurrently(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"books": books, "authors": authors})
 }
 
-func (h *BookHandler) ImportBooks(c *gin.Context) {
-	var author models.Author
-	if err := h.DB.First(&author, 1).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Author not found"})
-		return
-	}
-
-	var books []models.Book
-	for i := 1; i <= 100; i++ {
-		book := models.Book{
-			Title:       fmt.Sprintf("Book Title %d", i),
-			Description: fmt.Sprintf("Description for Book %d", i),
-			AuthorID:    author.ID,
-		}
-		books = append(books, book)
-	}
-
-	log.Printf("Books to import: %+v", books)
-
-	if len(books) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No books to import"})
-		return
-	}
-
-	for _, book := range books {
-		if err := h.DB.Create(&book).Error; err != nil {
-			log.Printf("Error importing book: %+v. Error: %v", book, err)
-			continue
-		}
-		log.Printf("Successfully imported book: %+v", book)
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("Successfully imported %d books", len(books)),
-	})
-}
-
 func (h *BookHandler) Restore(c *gin.Context) {
 	id := c.Param("id")
 	var book models.Book
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"shop-account/models"
+	"shop-account/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// maxGalleryImages is the largest gallery a book may have.
+const maxGalleryImages = 20
+
+var (
+	errGalleryFull       = fmt.Errorf("a book can have at most %d gallery images", maxGalleryImages)
+	errInvalidImageOrder = errors.New("image_ids must list every image of the book exactly once")
+)
+
+// findBookForImages loads the book named by the :id parameter, writing the
+// error response when it does not exist.
+func (h *BookHandler) findBookForImages(c *gin.Context) (models.Book, bool) {
+	var book models.Book
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return book, false
+	}
+	if err := h.DB.First(&book, bookID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve book"})
+		}
+		return book, false
+	}
+	return book, true
+}
+
+// GetBookImages returns the cover and the gallery of a book, in order.
+func (h *BookHandler) GetBookImages(c *gin.Context) {
+	book, ok := h.findBookForImages(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Where("book_id = ?", book.ID).Order("position ASC, id ASC").Find(&book.Images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve book images"})
+		return
+	}
+	books := []models.Book{book}
+	if err := attachBookImages(h.DB, books); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve book images"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cover_url":      books[0].CoverURL,
+		"cover_variants": books[0].CoverVariants,
+		"images":         books[0].Images,
+	})
+}
+
+// UploadBookCover sets the cover from the multipart field "image". The
+// previous cover file is deleted once the new one is saved.
+func (h *BookHandler) UploadBookCover(c *gin.Context) {
+	book, ok := h.findBookForImages(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required"})
+		return
+	}
+	upload, err := utils.ReadUploadedImage(file)
+	if err != nil {
+		c.JSON(utils.ImageErrorStatus(err), gin.H{"error": "Invalid image", "details": err.Error()})
+		return
+	}
+	object, err := utils.StoreImage(c.Request.Context(), fmt.Sprintf("books/%d", book.ID), upload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image", "details": err.Error()})
+		return
+	}
+
+	var previousKey string
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&book, book.ID).Error; err != nil {
+			return err
+		}
+		previousKey = book.CoverKey
+		book.CoverURL, book.CoverKey = object.URL, object.Key
+		return tx.Model(&book).UpdateColumns(map[string]interface{}{"cover_url": object.URL, "cover_key": object.Key}).Error
+	})
+	if err != nil {
+		utils.DeleteStoredObjects(object.Key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save book cover"})
+		return
+	}
+	utils.DeleteStoredImages(h.DB, previousKey)
+	utils.EnqueueImageVariants(object.Key, upload.Data)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book cover updated successfully", "cover_url": book.CoverURL})
+}
+
+// DeleteBookCover removes the cover of a book and its stored file.
+func (h *BookHandler) DeleteBookCover(c *gin.Context) {
+	book, ok := h.findBookForImages(c)
+	if !ok {
+		return
+	}
+
+	previousKey := book.CoverKey
+	if err := h.DB.Model(&book).UpdateColumns(map[string]interface{}{"cover_url": "", "cover_key": ""}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book cover"})
+		return
+	}
+	utils.DeleteStoredImages(h.DB, previousKey)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book cover deleted successfully"})
+}
+
+// AddBookImages appends the files of the multipart field "images" (or a
+// single "image") to the end of the gallery.
+func (h *BookHandler) AddBookImages(c *gin.Context) {
+	book, ok := h.findBookForImages(c)
+	if !ok {
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form", "details": err.Error()})
+		return
+	}
+	files := append([]*multipart.FileHeader{}, form.File["images"]...)
+	files = append(files, form.File["image"]...)
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one image file is required"})
+		return
+	}
+	if len(files) > maxGalleryImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errGalleryFull.Error()})
+		return
+	}
+
+	// Validate everything before storing anything, so one bad file does
+	// not leave the others half uploaded.
+	uploads := make([]utils.UploadedImage, 0, len(files))
+	for _, file := range files {
+		upload, err := utils.ReadUploadedImage(file)
+		if err != nil {
+			c.JSON(utils.ImageErrorStatus(err), gin.H{"error": "Invalid image", "file": file.Filename, "details": err.Error()})
+			return
+		}
+		uploads = append(uploads, upload)
+	}
+
+	var storedKeys []string
+	images := make([]models.BookImage, 0, len(uploads))
+	for _, upload := range uploads {
+		object, err := utils.StoreImage(c.Request.Context(), fmt.Sprintf("books/%d/gallery", book.ID), upload)
+		if err != nil {
+			utils.DeleteStoredObjects(storedKeys...)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image", "details": err.Error()})
+			return
+		}
+		storedKeys = append(storedKeys, object.Key)
+		images = append(images, models.BookImage{
+			BookID:      book.ID,
+			URL:         object.URL,
+			StorageKey:  object.Key,
+			ContentType: upload.ContentType,
+			Width:       upload.Width,
+			Height:      upload.Height,
+			Size:        object.Size,
+		})
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the book keeps concurrent uploads from taking the same
+		// positions.
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&models.Book{}, book.ID).Error; err != nil {
+			return err
+		}
+
+		var existing struct {
+			Count        int
+			LastPosition int
+		}
+		if err := tx.Model(&models.BookImage{}).Select("COUNT(*) AS count, COALESCE(MAX(position), -1) AS last_position").
+			Where("book_id = ?", book.ID).Scan(&existing).Error; err != nil {
+			return err
+		}
+		if existing.Count+len(images) > maxGalleryImages {
+			return errGalleryFull
+		}
+
+		for i := range images {
+			images[i].Position = existing.LastPosition + 1 + i
+			if err := tx.Create(&images[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.DeleteStoredObjects(storedKeys...)
+		if errors.Is(err, errGalleryFull) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save book images"})
+		return
+	}
+
+	for i, image := range images {
+		utils.EnqueueImageVariants(image.StorageKey, uploads[i].Data)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Book images added successfully", "images": images})
+}
+
+// ReorderBookImages sets the gallery order from image_ids, which must list
+// every image of the book exactly once.
+func (h *BookHandler) ReorderBookImages(c *gin.Context) {
+	book, ok := h.findBookForImages(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		ImageIDs []uint `json:"image_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	var images []models.BookImage
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("book_id = ?", book.ID).Find(&images).Error; err != nil {
+			return err
+		}
+
+		positions := make(map[uint]int, len(request.ImageIDs))
+		for i, imageID := range request.ImageIDs {
+			positions[imageID] = i
+		}
+		if len(positions) != len(images) || len(request.ImageIDs) != len(images) {
+			return errInvalidImageOrder
+		}
+		for i := range images {
+			position, ok := positions[images[i].ID]
+			if !ok {
+				return errInvalidImageOrder
+			}
+			images[i].Position = position
+			if err := tx.Model(&images[i]).UpdateColumn("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == errInvalidImageOrder {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder book images"})
+		return
+	}
+
+	h.GetBookImages(c)
+}
+
+// DeleteBookImage removes one gallery image and its stored file.
+func (h *BookHandler) DeleteBookImage(c *gin.Context) {
+	book, ok := h.findBookForImages(c)
+	if !ok {
+		return
+	}
+
+	var image models.BookImage
+	if err := h.DB.Where("id = ? AND book_id = ?", c.Param("image_id"), book.ID).First(&image).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book image not found"})
+		return
+	}
+
+	if err := h.DB.Unscoped().Delete(&image).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book image"})
+		return
+	}
+	utils.DeleteStoredImages(h.DB, image.StorageKey)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book image deleted successfully"})
+}
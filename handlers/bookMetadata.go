@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"shop-account/models"
+	"shop-account/utils"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// bookMetadata is the edition metadata accepted by the create, update and
+// patch book endpoints. Fields left out of the request keep their value; an
+// empty string (or 0 for publisher_id) clears them.
+type bookMetadata struct {
+	ISBN        *string      `json:"isbn"`
+	PublisherID *uint        `json:"publisher_id"`
+	PublishedAt *models.Date `json:"published_at"`
+	PageCount   *uint        `json:"page_count"`
+	Language    *string      `json:"language"`
+	Format      *string      `json:"format"`
+	Edition     *string      `json:"edition"`
+}
+
+// bookMetadataError is a metadata value rejected with status.
+type bookMetadataError struct {
+	status  int
+	message string
+}
+
+func (e *bookMetadataError) Error() string {
+	return e.message
+}
+
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// apply validates the metadata and copies it onto book. The ISBN must not
+// belong to another book.
+func (m bookMetadata) apply(db *gorm.DB, book *models.Book) error {
+	if m.ISBN != nil {
+		book.ISBN, book.ISBN10 = "", ""
+		if strings.TrimSpace(*m.ISBN) != "" {
+			isbn13, isbn10, err := utils.ParseISBN(*m.ISBN)
+			if err != nil {
+				return &bookMetadataError{http.StatusBadRequest, err.Error()}
+			}
+			if err := utils.CheckISBNAvailable(db, isbn13, book.ID); err != nil {
+				if errors.Is(err, utils.ErrISBNTaken) {
+					return &bookMetadataError{http.StatusConflict, err.Error()}
+				}
+				return err
+			}
+			book.ISBN, book.ISBN10 = isbn13, isbn10
+		}
+	}
+
+	if m.PublisherID != nil {
+		book.PublisherID, book.Publisher = nil, nil
+		if *m.PublisherID != 0 {
+			var publisher models.Publisher
+			if err := db.First(&publisher, *m.PublisherID).Error; err != nil {
+				if gorm.IsRecordNotFoundError(err) {
+					return &bookMetadataError{http.StatusBadRequest, "Publisher not found"}
+				}
+				return err
+			}
+			book.PublisherID = &publisher.ID
+		}
+	}
+
+	if m.PublishedAt != nil {
+		if m.PublishedAt.IsZero() {
+			book.PublishedAt = nil
+		} else if m.PublishedAt.After(time.Now().AddDate(2, 0, 0)) {
+			return &bookMetadataError{http.StatusBadRequest, "published_at is too far in the future"}
+		} else {
+			book.PublishedAt = m.PublishedAt
+		}
+	}
+	if m.PageCount != nil {
+		book.PageCount = *m.PageCount
+	}
+	if m.Language != nil {
+		language := strings.ToLower(strings.TrimSpace(*m.Language))
+		if language != "" && !languageTag.MatchString(language) {
+			return &bookMetadataError{http.StatusBadRequest, "language must be a language tag such as vi or en-US"}
+		}
+		book.Language = language
+	}
+	if m.Format != nil {
+		format := models.BookFormat(strings.ToLower(strings.TrimSpace(*m.Format)))
+		if format != "" && !format.IsValid() {
+			return &bookMetadataError{http.StatusBadRequest, "format must be hardcover, paperback or ebook"}
+		}
+		book.Format = format
+	}
+	if m.Edition != nil {
+		edition := strings.TrimSpace(*m.Edition)
+		if len(edition) > 100 {
+			return &bookMetadataError{http.StatusBadRequest, "edition is longer than 100 characters"}
+		}
+		book.Edition = edition
+	}
+	return nil
+}
+
+// metadataErrorResponse returns the status and message for an error from
+// bookMetadata.apply.
+func metadataErrorResponse(err error) (int, string) {
+	var metadataErr *bookMetadataError
+	if errors.As(err, &metadataErr) {
+		return metadataErr.status, metadataErr.message
+	}
+	return http.StatusInternalServerError, fmt.Sprintf("Failed to validate book metadata: %s", err.Error())
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"shop-account/dtos"
+	"shop-account/models"
+	"shop-account/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// optionalUserID returns the ID of the logged-in user, or 0 for anonymous
+// requests. It reads the ID set by SetUserIDMiddleware or by AuthMiddleware.
+func optionalUserID(c *gin.Context) uint {
+	if userID, exists := c.Get("id"); exists {
+		if userIDUint, ok := userID.(uint); ok {
+			return userIDUint
+		}
+	}
+	if userID, ok := currentUserID(c); ok {
+		return userID
+	}
+	return 0
+}
+
+// favoriteIDsByBook returns the favorite ID of each of bookIDs that userID
+// has marked as favorite, using a single query.
+func favoriteIDsByBook(db *gorm.DB, userID uint, bookIDs []uint) (map[uint]uint, error) {
+	favoriteIDs := make(map[uint]uint, len(bookIDs))
+	if userID == 0 || len(bookIDs) == 0 {
+		return favoriteIDs, nil
+	}
+
+	var favorites []models.FavoriteBook
+	if err := db.Select("id, book_id").Where("user_id = ? AND book_id IN (?)", userID, bookIDs).Find(&favorites).Error; err != nil {
+		return nil, err
+	}
+	for _, favorite := range favorites {
+		favoriteIDs[favorite.BookID] = favorite.ID
+	}
+	return favoriteIDs, nil
+}
+
+// buildBookResponses turns books (with Author and Categories preloaded) into
+// the response DTOs shared by the list, detail, search and favorites
+// endpoints. The favorite state, publishers, contributors and image variants
+// of the whole slice are loaded with one query each, so the number of queries
+// does not grow with the page size.
+func buildBookResponses(db *gorm.DB, books []models.Book, userID uint) ([]dtos.BookResponse, error) {
+	bookIDs := make([]uint, 0, len(books))
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID)
+	}
+	favoriteIDs, err := favoriteIDsByBook(db, userID, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachBookImages(db, books); err != nil {
+		return nil, err
+	}
+	publishers, err := publishersByID(db, books)
+	if err != nil {
+		return nil, err
+	}
+	contributors, err := utils.LoadBookContributors(db, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]dtos.BookResponse, 0, len(books))
+	for _, book := range books {
+		favoriteID, isFavorite := favoriteIDs[book.ID]
+		publisher := book.Publisher
+		if publisher == nil && book.PublisherID != nil {
+			publisher = publishers[*book.PublisherID]
+		}
+		responses = append(responses, dtos.BookResponse{
+			ID:              book.ID,
+			Code:            book.Code,
+			Title:           book.Title,
+			Description:     book.Description,
+			ISBN:            book.ISBN,
+			ISBN10:          book.ISBN10,
+			Publisher:       publisher,
+			PublishedAt:     book.PublishedAt,
+			PageCount:       book.PageCount,
+			Language:        book.Language,
+			Format:          book.Format,
+			Edition:         book.Edition,
+			Price:           book.Price,
+			CoverURL:        book.CoverURL,
+			CoverVariants:   book.CoverVariants,
+			Images:          book.Images,
+			Contributors:    contributorResponses(contributors[book.ID]),
+			Author:          book.Author,
+			Categories:      book.Categories,
+			IsFavorite:      isFavorite,
+			IdFavorite:      favoriteID,
+			QuantityInStock: book.QuantityInStock,
+			AverageRating:   book.AverageRating,
+			ReviewCount:     book.ReviewCount,
+		})
+	}
+	return responses, nil
+}
+
+// attachBookImages fills in the responsive variants of the covers, gallery
+// images and category images of books.
+func attachBookImages(db *gorm.DB, books []models.Book) error {
+	sources := map[string]string{}
+	for _, book := range books {
+		sources[book.CoverKey] = book.CoverURL
+		for _, image := range book.Images {
+			sources[image.StorageKey] = image.URL
+		}
+		for _, category := range book.Categories {
+			sources[category.ImageKey] = category.ImageURL
+		}
+	}
+	images, err := utils.LoadResponsiveImages(db, sources)
+	if err != nil {
+		return err
+	}
+
+	for i := range books {
+		books[i].CoverVariants = images[books[i].CoverKey]
+		for j := range books[i].Images {
+			books[i].Images[j].Variants = images[books[i].Images[j].StorageKey]
+		}
+		for j := range books[i].Categories {
+			books[i].Categories[j].ImageVariants = images[books[i].Categories[j].ImageKey]
+		}
+	}
+	return nil
+}
+
+// publishersByID loads the publishers of books that were not preloaded.
+func publishersByID(db *gorm.DB, books []models.Book) (map[uint]*models.Publisher, error) {
+	publishers := map[uint]*models.Publisher{}
+	var ids []uint
+	for _, book := range books {
+		if book.Publisher == nil && book.PublisherID != nil {
+			ids = append(ids, *book.PublisherID)
+		}
+	}
+	if len(ids) == 0 {
+		return publishers, nil
+	}
+
+	var found []models.Publisher
+	if err := db.Where("id IN (?)", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for i := range found {
+		publishers[found[i].ID] = &found[i]
+	}
+	return publishers, nil
+}
+
+func contributorResponses(contributors []models.BookContributor) []dtos.ContributorResponse {
+	responses := make([]dtos.ContributorResponse, 0, len(contributors))
+	for _, contributor := range contributors {
+		responses = append(responses, dtos.ContributorResponse{
+			AuthorID: contributor.AuthorID,
+			Code:     contributor.Author.Code,
+			Name:     contributor.Author.Name,
+			Role:     contributor.Role,
+			Position: contributor.Position,
+		})
+	}
+	return responses
+}
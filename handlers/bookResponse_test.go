@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shop-account/models"
+	"shop-account/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	countQueriesOnce sync.Once
+	countingQueries  int32
+	queryCount       int64
+)
+
+// countQueries returns the number of SELECT queries run by fn. gorm's
+// callbacks are shared by every connection, so they are registered once and
+// only count while fn runs.
+func countQueries(db *gorm.DB, fn func()) int64 {
+	countQueriesOnce.Do(func() {
+		count := func(scope *gorm.Scope) {
+			if atomic.LoadInt32(&countingQueries) == 1 {
+				atomic.AddInt64(&queryCount, 1)
+			}
+		}
+		db.Callback().Query().After("gorm:query").Register("test:count_queries", count)
+		db.Callback().RowQuery().After("gorm:row_query").Register("test:count_row_queries", count)
+	})
+
+	atomic.StoreInt64(&queryCount, 0)
+	atomic.StoreInt32(&countingQueries, 1)
+	defer atomic.StoreInt32(&countingQueries, 0)
+	fn()
+	return atomic.LoadInt64(&queryCount)
+}
+
+// TestGetBooksQueryCountIsConstant checks that a page of 50 books costs as
+// many queries as a page of 5: everything buildBookResponses adds is loaded
+// for the whole page at once.
+func TestGetBooksQueryCountIsConstant(t *testing.T) {
+	db := openTestDB(t)
+
+	suffix := time.Now().UnixNano()
+	author := models.Author{Name: fmt.Sprintf("Query count author %d", suffix), Active: true, Code: fmt.Sprintf("QCA%d", suffix)}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatal(err)
+	}
+	publisher := models.Publisher{Name: fmt.Sprintf("Query count publisher %d", suffix), Active: true, Code: fmt.Sprintf("QCP%d", suffix)}
+	if err := db.Create(&publisher).Error; err != nil {
+		t.Fatal(err)
+	}
+	category := models.Category{Name: fmt.Sprintf("Query count category %d", suffix), Code: fmt.Sprintf("QCC%d", suffix)}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, db, fmt.Sprintf("reader%d", suffix))
+
+	for i := 0; i < 60; i++ {
+		book := createTestBook(t, db, fmt.Sprintf("Query count book %d", i), author.ID, 3)
+		if err := db.Model(&book).UpdateColumns(map[string]interface{}{
+			"publisher_id": publisher.ID,
+			"cover_key":    fmt.Sprintf("books/query-count-%d-%d.png", suffix, i),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&models.BookCategory{BookID: book.ID, CategoryID: category.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := utils.SyncPrimaryAuthor(db, book.ID, author.ID); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if err := db.Create(&models.FavoriteBook{UserID: user.ID, BookID: book.ID}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	handler := &BookHandler{DB: db}
+	router := gin.New()
+	router.GET("/books/", func(c *gin.Context) {
+		c.Set("id", user.ID)
+		c.Next()
+	}, handler.GetBooks)
+
+	queriesFor := func(limit int) int64 {
+		return countQueries(db, func() {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+				fmt.Sprintf("/books/?author_id=%d&limit=%d&facets=false", author.ID, limit), nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("limit %d: status %d: %s", limit, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	small, large := queriesFor(5), queriesFor(50)
+	if small == 0 {
+		t.Fatal("no queries were counted")
+	}
+	if small != large {
+		t.Errorf("a page of 5 books ran %d queries but a page of 50 ran %d", small, large)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"shop-account/dtos"
+	"shop-account/models"
+	"shop-account/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSearchLimit = 100
+	// Suggestions are only looked up when a search finds fewer books.
+	suggestionThreshold = 3
+)
+
+// SearchBooks handles GET /books/search?q=...: a ranked full-text search over
+// title, description, author and category names that ignores diacritics and
+// tolerates typos. It accepts the catalog filters and sorts of GetBooks, with
+// relevance as the default order. Results carry highlighted title and snippet;
+// when few books match, similar titles and names are returned as suggestions.
+func (h *BookHandler) SearchBooks(c *gin.Context) {
+	term := strings.TrimSpace(c.Query("q"))
+	if term == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page number"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit)})
+		return
+	}
+
+	filter, err := utils.ParseBookFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schema, _ := utils.SchemaFor(&models.Book{})
+	query, err := schema.ApplyFilters(filter.Apply(h.DB, ""), c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hits, totalItems, err := utils.SearchBooks(h.DB, query, term, filter.Order, limit, (page-1)*limit)
+	if err != nil {
+		fmt.Printf("Error searching books for %q: %v\n", term, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search books"})
+		return
+	}
+
+	results, err := h.buildSearchResults(c, hits)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load books"})
+		return
+	}
+
+	response := gin.H{
+		"query":          term,
+		"current_page":   page,
+		"total_pages":    int(math.Ceil(float64(totalItems) / float64(limit))),
+		"total_items":    totalItems,
+		"items_per_page": limit,
+		"books":          results,
+	}
+
+	if c.DefaultQuery("facets", "true") != "false" {
+		facets, err := utils.ComputeBookFacets(h.DB, filter, utils.BookSearchScope(term), schema.FilterScope(c.Request.URL.Query()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute facets"})
+			return
+		}
+		response["facets"] = facets
+	}
+
+	if totalItems < suggestionThreshold {
+		suggestions, err := utils.SearchSuggestions(h.DB, term, 5)
+		if err != nil {
+			fmt.Printf("Error loading search suggestions for %q: %v\n", term, err)
+		}
+		response["suggestions"] = suggestions
+		if len(suggestions) > 0 {
+			response["did_you_mean"] = suggestions[0]
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// buildSearchResults loads the books of hits, keeping the ranking order.
+func (h *BookHandler) buildSearchResults(c *gin.Context, hits []utils.BookSearchHit) ([]dtos.BookSearchResult, error) {
+	results := make([]dtos.BookSearchResult, 0, len(hits))
+	if len(hits) == 0 {
+		return results, nil
+	}
+
+	bookIDs := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		bookIDs = append(bookIDs, hit.BookID)
+	}
+
+	var books []models.Book
+	if err := h.DB.Preload("Author").Preload("Categories").Where("id IN (?)", bookIDs).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	booksByID := make(map[uint]models.Book, len(books))
+	for _, book := range books {
+		booksByID[book.ID] = book
+	}
+
+	ordered := make([]models.Book, 0, len(hits))
+	for _, hit := range hits {
+		if book, ok := booksByID[hit.BookID]; ok {
+			ordered = append(ordered, book)
+		}
+	}
+	responses, err := buildBookResponses(h.DB, ordered, optionalUserID(c))
+	if err != nil {
+		return nil, err
+	}
+
+	hitsByID := make(map[uint]utils.BookSearchHit, len(hits))
+	for _, hit := range hits {
+		hitsByID[hit.BookID] = hit
+	}
+	for _, response := range responses {
+		hit := hitsByID[response.ID]
+		results = append(results, dtos.BookSearchResult{
+			BookResponse:   response,
+			Rank:           hit.Rank,
+			TitleHighlight: hit.TitleHighlight,
+			Snippet:        hit.Snippet,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"shop-account/dtos"
+	"shop-account/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type CartHandler struct {
+	DB *gorm.DB
+}
+
+// currentUserID returns the authenticated user ID that AuthMiddleware stored
+// in the context.
+func currentUserID(c *gin.Context) (uint, bool) {
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	userIDFloat, ok := userIDInterface.(float64)
+	if !ok {
+		return 0, false
+	}
+	return uint(userIDFloat), true
+}
+
+// findOrCreateCart returns the user's cart, creating an empty one on first use.
+// The insert ignores a conflict on user_id, so two first requests racing to
+// create the cart both end up reading the one that won.
+func findOrCreateCart(db *gorm.DB, userID uint) (models.Cart, error) {
+	var cart models.Cart
+	err := db.Where("user_id = ?", userID).First(&cart).Error
+	if !gorm.IsRecordNotFoundError(err) {
+		return cart, err
+	}
+
+	if err := db.Exec(`INSERT INTO carts (user_id, created_at, updated_at) VALUES (?, NOW(), NOW())
+		ON CONFLICT (user_id) DO NOTHING`, userID).Error; err != nil {
+		return cart, err
+	}
+	err = db.Where("user_id = ?", userID).First(&cart).Error
+	return cart, err
+}
+
+// buildCartResponse prices the cart with the live book prices and flags lines
+// that can no longer be fulfilled as they are.
+func buildCartResponse(cart models.Cart) dtos.CartResponse {
+	response := dtos.CartResponse{ID: cart.ID, Items: []dtos.CartItemResponse{}}
+
+	for _, item := range cart.Items {
+		line := dtos.CartItemResponse{
+			ID:              item.ID,
+			BookID:          item.BookID,
+			Title:           item.Book.Title,
+			Code:            item.Book.Code,
+			Quantity:        item.Quantity,
+			UnitPrice:       item.Book.Price,
+			LineTotal:       float64(item.Quantity) * item.Book.Price,
+			QuantityInStock: item.Book.QuantityInStock,
+			Available:       true,
+		}
+
+		switch {
+		case item.Book.ID == 0 || !item.Book.Active:
+			line.Available = false
+			line.LineTotal = 0
+			line.Warning = "Book is no longer available"
+		case item.Book.QuantityInStock == 0:
+			line.Available = false
+			line.LineTotal = 0
+			line.Warning = "Book is out of stock"
+		case item.Book.QuantityInStock < item.Quantity:
+			line.Available = false
+			line.Warning = fmt.Sprintf("Only %d left in stock", item.Book.QuantityInStock)
+		}
+
+		if line.Warning != "" {
+			response.HasWarnings = true
+		}
+		response.TotalItems += item.Quantity
+		response.TotalAmount += line.LineTotal
+		response.Items = append(response.Items, line)
+	}
+
+	return response
+}
+
+// loadCart reads the user's cart with its items and their books.
+func (h *CartHandler) loadCart(userID uint) (models.Cart, error) {
+	cart, err := findOrCreateCart(h.DB, userID)
+	if err != nil {
+		return cart, err
+	}
+	err = h.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("cart_items.id ASC")
+	}).Preload("Items.Book").First(&cart, cart.ID).Error
+	return cart, err
+}
+
+func (h *CartHandler) respondWithCart(c *gin.Context, userID uint, message string) {
+	cart, err := h.loadCart(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cart", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"cart":    buildCartResponse(cart),
+	})
+}
+
+// GetCart returns the current user's cart with live prices and stock warnings.
+func (h *CartHandler) GetCart(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	h.respondWithCart(c, userID, "Cart retrieved successfully")
+}
+
+// AddItem adds a book to the cart, merging it into the existing line when the
+// book is already there.
+func (h *CartHandler) AddItem(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var request dtos.CartItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	var book models.Book
+	if err := h.DB.Where("id = ? AND active = ?", request.BookID, true).First(&book).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found or inactive"})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		cart, err := findOrCreateCart(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// A single upsert, so concurrent adds of the same book add up instead
+		// of racing on the (cart_id, book_id) index.
+		return tx.Exec(`INSERT INTO cart_items (cart_id, book_id, quantity, created_at, updated_at)
+			VALUES (?, ?, ?, NOW(), NOW())
+			ON CONFLICT (cart_id, book_id) DO UPDATE
+			SET quantity = cart_items.quantity + EXCLUDED.quantity, updated_at = EXCLUDED.updated_at`,
+			cart.ID, book.ID, request.Quantity).Error
+	})
+	if err != nil {
+		fmt.Printf("Error adding book %d to cart: %v\n", book.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add book to cart"})
+		return
+	}
+
+	h.respondWithCart(c, userID, "Book added to cart")
+}
+
+// UpdateItem sets the quantity of one cart line.
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	itemID, err := strconv.Atoi(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart item ID"})
+		return
+	}
+
+	var request dtos.CartItemQuantityRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	item, err := h.findItem(userID, uint(itemID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+		return
+	}
+
+	if err := h.DB.Model(&item).UpdateColumn("quantity", request.Quantity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart item"})
+		return
+	}
+
+	h.respondWithCart(c, userID, "Cart item updated")
+}
+
+// RemoveItem removes one line from the cart.
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	itemID, err := strconv.Atoi(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart item ID"})
+		return
+	}
+
+	item, err := h.findItem(userID, uint(itemID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+		return
+	}
+
+	// Cart lines are hard-deleted so the (cart_id, book_id) unique index does
+	// not trip over soft-deleted rows when the book is added again.
+	if err := h.DB.Unscoped().Delete(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove cart item"})
+		return
+	}
+
+	h.respondWithCart(c, userID, "Cart item removed")
+}
+
+// ClearCart removes every line from the cart.
+func (h *CartHandler) ClearCart(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	cart, err := findOrCreateCart(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cart"})
+		return
+	}
+
+	if err := h.DB.Unscoped().Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+		return
+	}
+
+	h.respondWithCart(c, userID, "Cart cleared")
+}
+
+// Checkout turns the cart into a pending order and empties it.
+func (h *CartHandler) Checkout(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	checkoutCart(c, h.DB, userID)
+}
+
+func (h *CartHandler) findItem(userID uint, itemID uint) (models.CartItem, error) {
+	var item models.CartItem
+	err := h.DB.Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("cart_items.id = ? AND carts.user_id = ?", itemID, userID).
+		First(&item).Error
+	return item, err
+}
+
+// checkoutCart places an order for every line in the user's cart and clears
+// it, all inside one database transaction. It writes the HTTP response itself
+// so CartHandler.Checkout and TransactionHandler.CreateTransaction share it.
+func checkoutCart(c *gin.Context, db *gorm.DB, userID uint) {
+	var user models.User
+	if err := db.Where("id = ? AND active = ?", userID, true).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found or inactive"})
+		return
+	}
+
+	var transaction models.Transaction
+	emptyCart := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		cart, err := findOrCreateCart(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Lock the cart lines so a concurrent edit cannot change what is
+		// being ordered half way through.
+		var items []models.CartItem
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("cart_id = ?", cart.ID).Order("id ASC").Find(&items).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			emptyCart = true
+			return nil
+		}
+
+		var lines []orderLine
+		for _, item := range items {
+			lines = append(lines, orderLine{BookID: item.BookID, Quantity: item.Quantity})
+		}
+
+		transaction, err = placeOrder(tx, userID, lines)
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error
+	})
+	if err != nil {
+		respondCheckoutError(c, err)
+		return
+	}
+	if emptyCart {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "A transaction is created",
+		"transaction_code": transaction.Code,
+		"transaction":      transaction,
+	})
+}
@@ -7,14 +7,69 @@ import (
 	"shop-account/dtos"
 	"shop-account/utils"
 	"github.com/jinzhu/gorm"
-	"fmt"
-	
+	"strconv"
 )
 
 type CategoryHandler struct {
 	DB *gorm.DB
 }
 
+// storeCategoryImage stores the optional multipart field "image" as the
+// category image and returns the key of the image it replaces and the new
+// image content (nil without upload). It writes the error response and
+// returns false when the upload is invalid or fails.
+func storeCategoryImage(c *gin.Context, category *models.Category) (string, []byte, bool) {
+	previousKey := category.ImageKey
+	file, err := c.FormFile("image")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return previousKey, nil, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image", "details": err.Error()})
+		return previousKey, nil, false
+	}
+
+	upload, err := utils.ReadUploadedImage(file)
+	if err != nil {
+		c.JSON(utils.ImageErrorStatus(err), gin.H{"error": "Invalid image", "details": err.Error()})
+		return previousKey, nil, false
+	}
+	object, err := utils.StoreImage(c.Request.Context(), "categories", upload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image", "details": err.Error()})
+		return previousKey, nil, false
+	}
+	category.ImageURL, category.ImageKey = object.URL, object.Key
+	return previousKey, upload.Data, true
+}
+
+// attachCategoryImages fills in the responsive image variants of categories.
+func attachCategoryImages(db *gorm.DB, categories []models.Category) error {
+	sources := make(map[string]string, len(categories))
+	for _, category := range categories {
+		sources[category.ImageKey] = category.ImageURL
+	}
+	images, err := utils.LoadResponsiveImages(db, sources)
+	if err != nil {
+		return err
+	}
+	for i := range categories {
+		categories[i].ImageVariants = images[categories[i].ImageKey]
+	}
+	return nil
+}
+
+// writeCategory writes a single category response with its image variants.
+func (h *CategoryHandler) writeCategory(c *gin.Context, body gin.H, category models.Category) {
+	categories := []models.Category{category}
+	if err := attachCategoryImages(h.DB, categories); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load category image"})
+		return
+	}
+	body["category"] = categories[0]
+	c.JSON(http.StatusOK, body)
+}
+
 func (h *CategoryHandler) CreateCategory(c *gin.Context) {
     var categoryRequest dtos.CategoryRequest
 
@@ -35,33 +90,33 @@ func (h *CategoryHandler) CreateCategory(c *gin.Context) {
     }
     categoryData.Code = code
 
-    file, err := c.FormFile("image")
+    categoryData.ParentID = categoryParent(categoryRequest.ParentID)
 
-    if err == nil {
-        fileContent, err := file.Open()
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open image file", "details": err.Error()})
-            return
-        }
-        defer fileContent.Close() 
-
-        imageURL, err := utils.UploadImageToCloudinary(fileContent)
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image", "details": err.Error()})
-            return
-        }
-        categoryData.ImageURL = imageURL
-    } else if err != nil && err.Error() != "http: no such file" {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image", "details": err.Error()})
+    _, imageData, ok := storeCategoryImage(c, &categoryData)
+    if !ok {
         return
     }
 
-    if err := h.DB.Create(&categoryData).Error; err != nil {
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        // The tree lock keeps the parent's path stable while the new path is built.
+        if err := utils.LockCategoryTree(tx); err != nil {
+            return err
+        }
+        return tx.Create(&categoryData).Error
+    })
+    if err != nil {
+        utils.DeleteStoredObjects(categoryData.ImageKey)
+        if gorm.IsRecordNotFoundError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+            return
+        }
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"message": "Category created successfully", "category": categoryData})
+    utils.EnqueueImageVariants(categoryData.ImageKey, imageData)
+
+    h.writeCategory(c, gin.H{"message": "Category created successfully"}, categoryData)
 }
 
 
@@ -70,7 +125,12 @@ func (h *CategoryHandler) GetCategories(c *gin.Context) {
 
 	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, h.DB, &models.Category{}, &categories, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories", "details": err.Error()})
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch categories", "details": err.Error()})
+		return
+	}
+
+	if err := attachCategoryImages(h.DB, categories); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load category images"})
 		return
 	}
 
@@ -97,7 +157,22 @@ func (h *CategoryHandler) GetCategory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"category": category})
+	h.writeCategory(c, gin.H{}, category)
+}
+
+// GetCategoryByCode handles retrieving a category by its code.
+func (h *CategoryHandler) GetCategoryByCode(c *gin.Context) {
+	var category models.Category
+	if err := h.DB.Where("code = ?", c.Param("code")).First(&category).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve category"})
+		}
+		return
+	}
+
+	h.writeCategory(c, gin.H{}, category)
 }
 
 func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
@@ -126,30 +201,24 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	categoryData.Name = categoryRequest.Name
 	categoryData.Description = categoryRequest.Description
 
-	file, err := c.FormFile("image")
-	if err == nil {
-		fileContent, err := file.Open()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open image file", "details": err.Error()})
-			return
-		}
-		defer fileContent.Close() 
-
-		imageURL, err := utils.UploadImageToCloudinary(fileContent)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image", "details": err.Error()})
-			return
-		}
-		fmt.Printf("ImageUrl %s \n", imageURL)
-		categoryData.ImageURL = imageURL
+	previousKey, imageData, ok := storeCategoryImage(c, &categoryData)
+	if !ok {
+		return
 	}
 
-	if err := h.DB.Save(&categoryData).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category", "details": err.Error()})
+	if err := saveCategory(h.DB, &categoryData, categoryRequest.ParentID); err != nil {
+		if categoryData.ImageKey != previousKey {
+			utils.DeleteStoredObjects(categoryData.ImageKey)
+		}
+		writeCategoryTreeError(c, err, "Failed to update category")
 		return
 	}
+	if categoryData.ImageKey != previousKey {
+		utils.DeleteStoredImages(h.DB, previousKey)
+		utils.EnqueueImageVariants(categoryData.ImageKey, imageData)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "category": categoryData})
+	h.writeCategory(c, gin.H{"message": "Category updated successfully"}, categoryData)
 }
 
 
@@ -190,50 +259,289 @@ func (h *CategoryHandler) PatchCategory(c *gin.Context) {
         categoryData.Description = categoryRequest.Description
     }
 
-    file, err := c.FormFile("image")
-	if err == nil {
-		fileContent, err := file.Open()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open image file", "details": err.Error()})
-			return
-		}
-		defer fileContent.Close() 
-
-		imageURL, err := utils.UploadImageToCloudinary(fileContent)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image", "details": err.Error()})
-			return
-		}
-		categoryData.ImageURL = imageURL
-	}
+    previousKey, imageData, ok := storeCategoryImage(c, &categoryData)
+    if !ok {
+        return
+    }
 
-    if err := h.DB.Save(&categoryData).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+    if err := saveCategory(h.DB, &categoryData, categoryRequest.ParentID); err != nil {
+        if categoryData.ImageKey != previousKey {
+            utils.DeleteStoredObjects(categoryData.ImageKey)
+        }
+        writeCategoryTreeError(c, err, "Failed to update category")
         return
     }
+    if categoryData.ImageKey != previousKey {
+        utils.DeleteStoredImages(h.DB, previousKey)
+        utils.EnqueueImageVariants(categoryData.ImageKey, imageData)
+    }
 
-    c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "category": categoryData})
+    h.writeCategory(c, gin.H{"message": "Category updated successfully"}, categoryData)
 }
 
 
 
-// DeleteCategory handles deleting a category by its ID.
+// DeleteCategory handles deleting a category by its ID. By default a
+// category that still has subcategories or books is not deleted (409).
+// With ?strategy=reassign its subcategories move up to its parent and its
+// books move to ?reassign_to, or to its parent when that is not given.
 func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
-	id := c.Param("id")
+	category, ok := h.findCategory(c)
+	if !ok {
+		return
+	}
+
+	var plan utils.CategoryDeletePlan
+	switch c.DefaultQuery("strategy", "block") {
+	case "block":
+	case "reassign":
+		plan.Reassign = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "strategy must be block or reassign"})
+		return
+	}
+	if value := c.Query("reassign_to"); value != "" {
+		target, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || target == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reassign_to"})
+			return
+		}
+		if uint(target) == category.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Books cannot be reassigned to the category being deleted"})
+			return
+		}
+		targetID := uint(target)
+		plan.BooksTo = &targetID
+	}
+
+	var result utils.CategoryDeleteResult
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = utils.DeleteCategory(tx, &category, plan)
+		return err
+	})
+	if err != nil {
+		if notEmpty, ok := err.(*utils.CategoryNotEmptyError); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "Category has subcategories or books; delete with strategy=reassign to move them",
+				"subcategories": notEmpty.Children,
+				"books":         notEmpty.Books,
+			})
+			return
+		}
+		if err == utils.ErrNoReassignTarget {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Category to reassign books to not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully", "result": result})
+}
+
+// findCategory loads the category of the :id parameter, writing the error
+// response and returning false when it cannot.
+func (h *CategoryHandler) findCategory(c *gin.Context) (models.Category, bool) {
 	var category models.Category
-	if err := h.DB.First(&category, id).Error; err != nil {
+	if err := h.DB.First(&category, c.Param("id")).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve category"})
 		}
+		return category, false
+	}
+	return category, true
+}
+
+// categoryParent turns the parent_id of a request, where 0 means the top
+// level, into the ParentID of a category.
+func categoryParent(parentID *uint) *uint {
+	if parentID == nil || *parentID == 0 {
+		return nil
+	}
+	return parentID
+}
+
+// saveCategory saves the fields of category and, when parentID is set, moves
+// it under that parent. The tree columns are only ever written by
+// MoveCategory, so a concurrent move of an ancestor is never undone.
+func saveCategory(db *gorm.DB, category *models.Category, parentID *uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("parent_id", "path", "depth").Save(category).Error; err != nil {
+			return err
+		}
+		if parentID == nil {
+			return nil
+		}
+		moved := models.Category{Model: gorm.Model{ID: category.ID}}
+		if err := utils.MoveCategory(tx, &moved, categoryParent(parentID)); err != nil {
+			return err
+		}
+		category.ParentID, category.Path, category.Depth = moved.ParentID, moved.Path, moved.Depth
+		return nil
+	})
+}
+
+// writeCategoryTreeError writes the response for an error of saveCategory or
+// MoveCategory.
+func writeCategoryTreeError(c *gin.Context, err error, message string) {
+	switch {
+	case err == utils.ErrCategoryCycle:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case gorm.IsRecordNotFoundError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
+}
+
+// MoveCategory places the category and its subtree under parent_id, or at
+// the top level when parent_id is null. Moving a category under itself or
+// one of its descendants is refused with 409.
+func (h *CategoryHandler) MoveCategory(c *gin.Context) {
+	category, ok := h.findCategory(c)
+	if !ok {
+		return
+	}
+
+	var request dtos.MoveCategoryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return utils.MoveCategory(tx, &category, categoryParent(request.ParentID))
+	})
+	if err != nil {
+		writeCategoryTreeError(c, err, "Failed to move category")
+		return
+	}
+
+	h.writeCategory(c, gin.H{"message": "Category moved successfully"}, category)
+}
+
+// GetCategoryTree returns every category nested under its parent, or only
+// the subtree of ?root=id.
+func (h *CategoryHandler) GetCategoryTree(c *gin.Context) {
+	query := h.DB.Order("depth, name, id")
+	var rootID uint
+	if value := c.Query("root"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid root"})
+			return
+		}
+		var root models.Category
+		if err := h.DB.First(&root, id).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve category"})
+			}
+			return
+		}
+		rootID = root.ID
+		query = query.Where("path LIKE ?", root.Path+"%")
+	}
+
+	var categories []models.Category
+	if err := query.Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories", "details": err.Error()})
+		return
+	}
+	if err := attachCategoryImages(h.DB, categories); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load category images"})
 		return
 	}
 
-	if err := h.DB.Delete(&category).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+	children := make(map[uint][]models.Category, len(categories))
+	var top []models.Category
+	for _, category := range categories {
+		switch {
+		case rootID != 0 && category.ID == rootID, rootID == 0 && category.ParentID == nil:
+			top = append(top, category)
+		case category.ParentID != nil:
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+	var build func(categories []models.Category) []dtos.CategoryNode
+	build = func(categories []models.Category) []dtos.CategoryNode {
+		nodes := make([]dtos.CategoryNode, 0, len(categories))
+		for _, category := range categories {
+			nodes = append(nodes, dtos.CategoryNode{Category: category, Children: build(children[category.ID])})
+		}
+		return nodes
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": build(top)})
+}
+
+// GetCategoryBreadcrumbs returns the ancestors of a category from the top
+// level down, ending with the category itself.
+func (h *CategoryHandler) GetCategoryBreadcrumbs(c *gin.Context) {
+	category, ok := h.findCategory(c)
+	if !ok {
+		return
+	}
+
+	breadcrumbs, err := utils.CategoryBreadcrumbs(h.DB, category)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch breadcrumbs", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"breadcrumbs": breadcrumbs})
+}
+
+// GetCategoryBooks lists the books of a category and, unless
+// ?include_descendants=false, of all its subcategories. It takes the catalog
+// filters of GetBooks.
+func (h *CategoryHandler) GetCategoryBooks(c *gin.Context) {
+	category, ok := h.findCategory(c)
+	if !ok {
+		return
+	}
+
+	includeDescendants, err := strconv.ParseBool(c.DefaultQuery("include_descendants", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid include_descendants"})
+		return
+	}
+	filter, err := utils.ParseBookFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := filter.Apply(h.DB.Preload("Author").Preload("Categories"), "")
+	if includeDescendants {
+		query = query.Scopes(utils.CategorySubtreeScope(category))
+	} else {
+		query = query.Where("books.id IN (SELECT book_id FROM book_categories WHERE category_id = ?)", category.ID)
+	}
+	if c.Query("sort") == "" {
+		query = query.Order("books.id DESC")
+	}
+
+	var books []models.Book
+	response, err := utils.PaginateList(c, query, &models.Book{}, &books)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch books", "details": err.Error()})
+		return
+	}
+	bookResponses, err := buildBookResponses(h.DB, books, optionalUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+	response["category"] = category
+	response["books"] = bookResponses
+	c.JSON(http.StatusOK, response)
 }
@@ -128,7 +128,7 @@ func (h *FavoriteBookHandler) GetUserFavoriteBooks(c *gin.Context) {
 	userID := uint(userIDFloat)
 
 	var favoriteBooks []models.FavoriteBook
-	if err := h.DB.Preload("Book").Where("user_id = ?", userID).Find(&favoriteBooks).Error; err != nil {
+	if err := h.DB.Preload("Book").Preload("Book.Author").Preload("Book.Categories").Where("user_id = ?", userID).Find(&favoriteBooks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve favorite books"})
 		return
 	}
@@ -143,7 +143,14 @@ func (h *FavoriteBookHandler) GetUserFavoriteBooks(c *gin.Context) {
 		books = append(books, favorite.Book)
 	}
 
+	bookResponses, err := buildBookResponses(h.DB, books, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve favorite books"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"favorite_books": favoriteBooks,
+		"books":          bookResponses,
 	})
 }
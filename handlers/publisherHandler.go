@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"shop-account/models"
+	"shop-account/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type PublisherHandler struct {
+	DB *gorm.DB
+}
+
+// publisherRequest is the body of the create, update and patch endpoints.
+// Nil fields are left unchanged by PATCH.
+type publisherRequest struct {
+	Name    *string `json:"name"`
+	Country *string `json:"country"`
+	Website *string `json:"website"`
+	Active  *bool   `json:"active"`
+}
+
+// apply copies the request onto publisher and checks the name.
+func (r publisherRequest) apply(publisher *models.Publisher) error {
+	if r.Name != nil {
+		publisher.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Country != nil {
+		publisher.Country = strings.TrimSpace(*r.Country)
+	}
+	if r.Website != nil {
+		publisher.Website = strings.TrimSpace(*r.Website)
+	}
+	if r.Active != nil {
+		publisher.Active = *r.Active
+	}
+	if publisher.Name == "" {
+		return fmt.Errorf("Publisher name is required")
+	}
+	return nil
+}
+
+// findPublisher loads the publisher of the :id parameter, writing the error
+// response when it cannot.
+func (h *PublisherHandler) findPublisher(c *gin.Context) (models.Publisher, bool) {
+	var publisher models.Publisher
+	publisherID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid publisher ID"})
+		return publisher, false
+	}
+	if err := h.DB.First(&publisher, publisherID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Publisher not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve publisher"})
+		}
+		return publisher, false
+	}
+	return publisher, true
+}
+
+// GetPublishers lists publishers with the usual pagination, filter, search
+// and sort parameters.
+func (h *PublisherHandler) GetPublishers(c *gin.Context) {
+	var publishers []models.Publisher
+
+	response, err := utils.PaginateList(c, h.DB, &models.Publisher{}, &publishers)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch publishers", "details": err.Error()})
+		return
+	}
+
+	response["publishers"] = publishers
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *PublisherHandler) CreatePublisher(c *gin.Context) {
+	var request publisherRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Printf("Error binding JSON: %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Error binding JSON: %s", err.Error())})
+		return
+	}
+
+	publisher := models.Publisher{Active: true}
+	if err := request.apply(&publisher); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code, err := utils.GenerateCode(h.DB, &models.Publisher{})
+	if err != nil {
+		fmt.Printf("Error generating publisher code: %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate publisher code: %s", err.Error())})
+		return
+	}
+	publisher.Code = code
+
+	if err := h.DB.Create(&publisher).Error; err != nil {
+		fmt.Printf("Error creating publisher in DB: %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create publisher"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, publisher)
+}
+
+func (h *PublisherHandler) GetPublisherByID(c *gin.Context) {
+	publisher, ok := h.findPublisher(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, publisher)
+}
+
+// GetPublisherByCode looks a publisher up by its code, e.g. /publishers/code/PU0003.
+func (h *PublisherHandler) GetPublisherByCode(c *gin.Context) {
+	var publisher models.Publisher
+	if err := h.DB.Where("code = ?", c.Param("code")).First(&publisher).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Publisher not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve publisher"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, publisher)
+}
+
+// GetPublisherBooks lists the books of a publisher, newest edition first by
+// default.
+func (h *PublisherHandler) GetPublisherBooks(c *gin.Context) {
+	publisher, ok := h.findPublisher(c)
+	if !ok {
+		return
+	}
+
+	var books []models.Book
+	query := h.DB.Preload("Author").Preload("Categories").Where("books.publisher_id = ?", publisher.ID)
+	if c.Query("sort") == "" {
+		query = query.Order("books.published_at DESC NULLS LAST, books.id DESC")
+	}
+	response, err := utils.PaginateList(c, query, &models.Book{}, &books)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch books", "details": err.Error()})
+		return
+	}
+
+	for i := range books {
+		books[i].Publisher = &publisher
+	}
+	bookResponses, err := buildBookResponses(h.DB, books, optionalUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books", "details": err.Error()})
+		return
+	}
+
+	response["publisher"] = publisher
+	response["books"] = bookResponses
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdatePublisher replaces the publisher's fields; PatchPublisher only
+// changes the ones sent. The code never changes.
+func (h *PublisherHandler) UpdatePublisher(c *gin.Context) {
+	h.savePublisher(c, false)
+}
+
+func (h *PublisherHandler) PatchPublisher(c *gin.Context) {
+	h.savePublisher(c, true)
+}
+
+func (h *PublisherHandler) savePublisher(c *gin.Context, partial bool) {
+	publisher, ok := h.findPublisher(c)
+	if !ok {
+		return
+	}
+
+	var request publisherRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data", "details": err.Error()})
+		return
+	}
+	if !partial {
+		empty := ""
+		for _, field := range []**string{&request.Country, &request.Website} {
+			if *field == nil {
+				*field = &empty
+			}
+		}
+		if request.Name == nil {
+			request.Name = &empty
+		}
+	}
+	if err := request.apply(&publisher); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&publisher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update publisher"})
+		return
+	}
+
+	c.JSON(http.StatusOK, publisher)
+}
+
+// DeletePublisher soft deletes a publisher that no book refers to.
+func (h *PublisherHandler) DeletePublisher(c *gin.Context) {
+	publisher, ok := h.findPublisher(c)
+	if !ok {
+		return
+	}
+
+	var books int64
+	if err := h.DB.Model(&models.Book{}).Where("publisher_id = ?", publisher.ID).Count(&books).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete publisher"})
+		return
+	}
+	if books > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Publisher still has %d books, move them to another publisher first", books)})
+		return
+	}
+
+	if err := h.DB.Delete(&publisher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete publisher"})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
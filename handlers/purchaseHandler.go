@@ -10,11 +10,116 @@ import (
 	"strconv"
 	"fmt"
 	"time"
+	"errors"
 )
 
 type PurchaseHandler struct {
     DB *gorm.DB
 }
+// orderLine is a book and quantity to be turned into a Purchase by placeOrder.
+type orderLine struct {
+    BookID   uint
+    Quantity uint
+}
+
+// placeOrder creates a pending Transaction and, for every line, reserves the
+// stock and creates a Purchase priced at the current book price. It must be
+// called inside a database transaction so a failed line rolls back the rest.
+func placeOrder(tx *gorm.DB, userID uint, lines []orderLine) (models.Transaction, error) {
+    var transaction models.Transaction
+
+    var user models.User
+    if err := tx.First(&user, userID).Error; err != nil {
+        return transaction, err
+    }
+
+    // Generate unique code for the transaction
+    code, err := utils.GenerateCode(tx, &models.Transaction{})
+    if err != nil {
+        return transaction, fmt.Errorf("failed to generate transaction code: %v", err)
+    }
+
+    transaction = models.Transaction{
+        UserID: userID,
+        Status: models.Pending,
+        Code:   code,
+    }
+    if err := tx.Create(&transaction).Error; err != nil {
+        return transaction, err
+    }
+
+    if err := tx.Create(&models.TransactionStatusHistory{
+        TransactionID: transaction.ID,
+        ToStatus:      transaction.Status,
+        ActorID:       user.ID,
+        ActorUsername: user.Username,
+        Reason:        "order placed",
+    }).Error; err != nil {
+        return transaction, err
+    }
+
+    for _, line := range lines {
+        // Generate unique code for the purchase
+        code, err := utils.GenerateCode(tx, &models.Purchase{})
+        if err != nil {
+            return transaction, fmt.Errorf("failed to generate purchase code: %v", err)
+        }
+
+        ref := utils.StockMovementRef{
+            Reference:     code,
+            ActorID:       user.ID,
+            ActorUsername: user.Username,
+            Reason:        fmt.Sprintf("sold in transaction %s", transaction.Code),
+        }
+        if err := utils.ReserveStock(tx, line.BookID, line.Quantity, ref); err != nil {
+            return transaction, err
+        }
+
+        var book models.Book
+        if err := tx.First(&book, line.BookID).Error; err != nil {
+            return transaction, err
+        }
+
+        purchase := models.Purchase{
+            UserID:        userID,
+            BookID:        book.ID,
+            Book:          book,
+            Quantity:      line.Quantity,
+            BookPrice:     book.Price,
+            TransactionID: transaction.ID,
+            Code:          code,
+        }
+        if err := tx.Set("gorm:association_autoupdate", false).Create(&purchase).Error; err != nil {
+            return transaction, err
+        }
+
+        transaction.Purchases = append(transaction.Purchases, purchase)
+        transaction.TotalAmount += float64(line.Quantity) * book.Price
+    }
+
+    if err := tx.Model(&transaction).UpdateColumn("total_amount", transaction.TotalAmount).Error; err != nil {
+        return transaction, err
+    }
+
+    return transaction, nil
+}
+
+// respondCheckoutError maps errors from placeOrder to HTTP responses.
+func respondCheckoutError(c *gin.Context, err error) {
+    if stockErr, ok := err.(*utils.StockError); ok {
+        c.JSON(http.StatusConflict, gin.H{
+            "error":             stockErr.Error(),
+            "book_id":           stockErr.BookID,
+            "quantity_in_stock": stockErr.Available,
+        })
+        return
+    }
+    fmt.Printf("Error placing order: %v\n", err)
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order", "details": err.Error()})
+}
+
+// BuyBook places a single-line order for one book straight away, bypassing
+// the cart.
 func (h *PurchaseHandler) BuyBook(c *gin.Context) {
     userID, exists := c.Get("user_id")
     if !exists {
@@ -42,56 +147,32 @@ func (h *PurchaseHandler) BuyBook(c *gin.Context) {
         return
     }
 
-    if book.QuantityInStock < purchaseRequest.Quantity {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": fmt.Sprintf("Not enough stock available, the quantity that can be chosen is %d", book.QuantityInStock),
-        })
-        return
-    }
-
     var user models.User
     if err := h.DB.Where("id = ? AND active = ?", userID, true).First(&user).Error; err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "User not found or inactive"})
         return
     }
 
-    purchase := models.Purchase{
-        UserID:   user.ID,
-        BookID:   book.ID,
-        Quantity: purchaseRequest.Quantity,
-        BookPrice: book.Price,
-    }
-
-    // Generate unique code for the purchase
-    code, err := utils.GenerateCode(h.DB, &models.Purchase{})
+    // Stock reservation and order creation run in one transaction, so a
+    // purchase row exists if and only if its stock was actually taken.
+    var transaction models.Transaction
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        var err error
+        transaction, err = placeOrder(tx, user.ID, []orderLine{{BookID: book.ID, Quantity: purchaseRequest.Quantity}})
+        return err
+    })
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate purchase code", "details": err.Error()})
-        return
-    }
-    purchase.Code = code
-
-    if err := h.DB.Create(&purchase).Error; err != nil {
-        fmt.Printf("Error creating purchase: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purchase book"})
-        return
-    }
-
-    book.QuantityInStock -= purchaseRequest.Quantity
-    book.QuantitySold += purchaseRequest.Quantity
-
-    if err := h.DB.Save(&book).Error; err != nil {
-        fmt.Printf("Error updating book: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book stock"})
+        respondCheckoutError(c, err)
         return
     }
 
     c.JSON(http.StatusOK, gin.H{
-        "message": "Book purchased successfully",
-        "purchase": purchase,
+        "message":          "Book purchased successfully",
+        "purchase":         transaction.Purchases[0],
+        "transaction_code": transaction.Code,
     })
 }
 
-
 // func (h *PurchaseHandler) BuyBook(c *gin.Context) {
 //     userID, exists := c.Get("user_id")
 //     if !exists {
@@ -169,17 +250,19 @@ func (h *PurchaseHandler) GetUserPurchases(c *gin.Context) {
     // Preload related data and filter by user_id
     query := h.DB.Preload("Book").Preload("User").Preload("Transaction").Where("user_id = ?", userID)
 
-    // Call PaginateAndSearch utility to fetch paginated data with dynamic search (if any)
-    totalItems, page, totalPages, err := utils.PaginateAndSearch(c, query, &models.Purchase{}, &purchases, nil)
+    // Fetch one page, in offset or cursor mode, with dynamic search (if any)
+    response, err := utils.PaginateList(c, query, &models.Purchase{}, &purchases)
     if err != nil {
         fmt.Printf("Error fetching purchases for user_id %v: %v\n", userID, err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchases"})
+        c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch purchases", "details": err.Error()})
         return
     }
 
     // If no purchases found, return empty response
     if len(purchases) == 0 {
-        c.JSON(http.StatusOK, gin.H{"message": "No purchases found for this user", "purchases": []dtos.PurchaseResponse{}})
+        response["message"] = "No purchases found for this user"
+        response["purchases"] = []dtos.PurchaseResponse{}
+        c.JSON(http.StatusOK, response)
         return
     }
 
@@ -204,17 +287,58 @@ func (h *PurchaseHandler) GetUserPurchases(c *gin.Context) {
     }
 
     // Return the paginated purchases response
-    c.JSON(http.StatusOK, gin.H{
-        "message":   "User purchases retrieved successfully",
-        "current_page":   page,
-        "total_pages":    totalPages,
-        "total_items":    totalItems,
-        "items_per_page": c.DefaultQuery("limit", "10"),
-        "purchases":      purchaseResponses,
-    })
+    response["message"] = "User purchases retrieved successfully"
+    response["purchases"] = purchaseResponses
+    c.JSON(http.StatusOK, response)
 }
 
 
+// errOrderLocked aborts an order line change when the order has left the
+// pending status.
+var errOrderLocked = errors.New("only order lines of pending transactions can be changed")
+
+// lockPendingOrderLine loads and locks a purchase of the user together with
+// its transaction, and refuses to go on unless the transaction is pending.
+func lockPendingOrderLine(tx *gorm.DB, purchaseID int, userID interface{}) (models.Purchase, models.Transaction, error) {
+    var purchase models.Purchase
+    var transaction models.Transaction
+    if err := tx.Set("gorm:query_option", "FOR UPDATE").
+        Where("id = ? AND user_id = ?", purchaseID, userID).First(&purchase).Error; err != nil {
+        return purchase, transaction, err
+    }
+    if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&transaction, purchase.TransactionID).Error; err != nil {
+        return purchase, transaction, err
+    }
+    if transaction.Status != models.Pending {
+        return purchase, transaction, errOrderLocked
+    }
+    return purchase, transaction, nil
+}
+
+// respondOrderLineError maps errors from order line changes to HTTP responses.
+func respondOrderLineError(c *gin.Context, err error, action string) {
+    if gorm.IsRecordNotFoundError(err) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found or you don't have access"})
+        return
+    }
+    if err == errOrderLocked {
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+        return
+    }
+    if stockErr, ok := err.(*utils.StockError); ok {
+        c.JSON(http.StatusConflict, gin.H{
+            "error":             stockErr.Error(),
+            "book_id":           stockErr.BookID,
+            "quantity_in_stock": stockErr.Available,
+        })
+        return
+    }
+    fmt.Printf("Error trying to %s purchase: %v\n", action, err)
+    c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to %s purchase", action)})
+}
+
+// UpdatePurchase changes the quantity of an order line of a pending
+// transaction, taking or giving back the difference in stock.
 func (h *PurchaseHandler) UpdatePurchase(c *gin.Context) {
     userID, exists := c.Get("user_id")
     if !exists {
@@ -230,24 +354,46 @@ func (h *PurchaseHandler) UpdatePurchase(c *gin.Context) {
         return
     }
 
-    var purchase models.Purchase
-    if err := h.DB.Where("id = ? AND user_id = ?", id, userID).First(&purchase).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found or you don't have access"})
-        return
-    }
-
     var input struct {
-        Quantity uint `json:"quantity"`
+        Quantity uint `json:"quantity" binding:"required"`
     }
     if err := c.ShouldBindJSON(&input); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
         return
     }
 
-    purchase.Quantity = input.Quantity
-    if err := h.DB.Save(&purchase).Error; err != nil {
-        fmt.Printf("Error updating purchase: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase"})
+    var purchase models.Purchase
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        var err error
+        purchase, _, err = lockPendingOrderLine(tx, id, userID)
+        if err != nil {
+            return err
+        }
+
+        ref := utils.StockMovementRef{
+            Reference:     purchase.Code,
+            ActorID:       purchase.UserID,
+            ActorUsername: c.GetString("username"),
+            Reason:        fmt.Sprintf("order line quantity changed from %d to %d", purchase.Quantity, input.Quantity),
+        }
+        if input.Quantity > purchase.Quantity {
+            if err := utils.ReserveStock(tx, purchase.BookID, input.Quantity-purchase.Quantity, ref); err != nil {
+                return err
+            }
+        } else if input.Quantity < purchase.Quantity {
+            if err := utils.ReleaseStock(tx, purchase.BookID, purchase.Quantity-input.Quantity, models.MovementReturn, ref); err != nil {
+                return err
+            }
+        }
+
+        purchase.Quantity = input.Quantity
+        if err := tx.Model(&purchase).UpdateColumn("quantity", purchase.Quantity).Error; err != nil {
+            return err
+        }
+        return utils.RecalculateTransactionTotal(tx, purchase.TransactionID)
+    })
+    if err != nil {
+        respondOrderLineError(c, err, "update")
         return
     }
 
@@ -257,7 +403,8 @@ func (h *PurchaseHandler) UpdatePurchase(c *gin.Context) {
     })
 }
 
-// DeletePurchase - Marks a purchase as deleted (soft delete)
+// DeletePurchase removes an order line from a pending transaction and gives
+// its stock back. Removing the last line cancels the transaction.
 func (h *PurchaseHandler) DeletePurchase(c *gin.Context) {
     userID, exists := c.Get("user_id")
     if !exists {
@@ -273,20 +420,43 @@ func (h *PurchaseHandler) DeletePurchase(c *gin.Context) {
         return
     }
 
-    var purchase models.Purchase
-    if err := h.DB.Where("id = ? AND user_id = ?", id, userID).First(&purchase).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found or you don't have access"})
-        return
-    }
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        purchase, transaction, err := lockPendingOrderLine(tx, id, userID)
+        if err != nil {
+            return err
+        }
+
+        ref := utils.StockMovementRef{
+            Reference:     purchase.Code,
+            ActorID:       purchase.UserID,
+            ActorUsername: c.GetString("username"),
+            Reason:        "order line removed",
+        }
+        if err := utils.ReleaseStock(tx, purchase.BookID, purchase.Quantity, models.MovementReturn, ref); err != nil {
+            return err
+        }
+        if err := tx.Delete(&purchase).Error; err != nil {
+            return err
+        }
+        if err := utils.RecalculateTransactionTotal(tx, transaction.ID); err != nil {
+            return err
+        }
 
-    // Perform soft delete by setting the DeletedAt timestamp
-    if err := h.DB.Model(&purchase).Update("deleted_at", time.Now()).Error; err != nil {
-        fmt.Printf("Error deleting purchase: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase"})
+        var remaining int
+        if err := tx.Model(&models.Purchase{}).Where("transaction_id = ?", transaction.ID).Count(&remaining).Error; err != nil {
+            return err
+        }
+        if remaining == 0 {
+            return utils.ChangeTransactionStatus(tx, &transaction, models.Cancelled, purchase.UserID, c.GetString("username"), "all order lines removed")
+        }
+        return nil
+    })
+    if err != nil {
+        respondOrderLineError(c, err, "delete")
         return
     }
 
     c.JSON(http.StatusOK, gin.H{
         "message": "Purchase deleted successfully",
     })
-}
\ No newline at end of file
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shop-account/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestBuyBookConcurrentNeverOversells fires many parallel single-unit
+// purchases at a book with less stock than buyers. Exactly the available
+// units must be sold, the losers must get 409 and the ledger must still add
+// up to the stock.
+func TestBuyBookConcurrentNeverOversells(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		stock  = 5
+		buyers = 40
+	)
+	suffix := time.Now().UnixNano()
+	book := createTestBook(t, db, fmt.Sprintf("Concurrent stock %d", suffix), 0, stock)
+	user := createTestUser(t, db, fmt.Sprintf("buyer%d", suffix))
+
+	handler := &PurchaseHandler{DB: db}
+	router := gin.New()
+	router.POST("/purchase/:book_id", func(c *gin.Context) {
+		c.Set("user_id", float64(user.ID))
+		c.Next()
+	}, handler.BuyBook)
+
+	var (
+		wg       sync.WaitGroup
+		start    = make(chan struct{})
+		statuses = make(chan int, buyers)
+	)
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/purchase/%d", book.ID), strings.NewReader(`{"quantity":1}`))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			statuses <- recorder.Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != stock {
+		t.Errorf("successful purchases = %d, want %d (statuses %v)", counts[http.StatusOK], stock, counts)
+	}
+	if counts[http.StatusConflict] != buyers-stock {
+		t.Errorf("409 responses = %d, want %d (statuses %v)", counts[http.StatusConflict], buyers-stock, counts)
+	}
+
+	// Read the raw column: a negative stock would wrap around in the uint field.
+	var inStock int
+	if err := db.Model(&models.Book{}).Where("id = ?", book.ID).Select("quantity_in_stock").Row().Scan(&inStock); err != nil {
+		t.Fatal(err)
+	}
+	if inStock != 0 {
+		t.Errorf("quantity_in_stock = %d, want 0", inStock)
+	}
+	var after models.Book
+	if err := db.First(&after, book.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.QuantitySold != uint(counts[http.StatusOK]) {
+		t.Errorf("quantity_sold = %d, want the %d units taken", after.QuantitySold, counts[http.StatusOK])
+	}
+
+	var purchased int
+	if err := db.Model(&models.Purchase{}).Where("book_id = ?", book.ID).
+		Select("COALESCE(SUM(quantity), 0)").Row().Scan(&purchased); err != nil {
+		t.Fatal(err)
+	}
+	if purchased != int(after.QuantitySold) {
+		t.Errorf("purchased quantity = %d, want quantity_sold %d", purchased, after.QuantitySold)
+	}
+
+	var ledger struct {
+		Total int
+		Sales int
+	}
+	if err := db.Model(&models.StockMovement{}).Where("book_id = ?", book.ID).
+		Select("COALESCE(SUM(quantity_delta), 0) AS total, COUNT(*) FILTER (WHERE type = ?) AS sales", models.MovementSale).
+		Scan(&ledger).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ledger.Total != int(after.QuantityInStock) {
+		t.Errorf("ledger sum = %d, want quantity_in_stock %d", ledger.Total, after.QuantityInStock)
+	}
+	if ledger.Sales != counts[http.StatusOK] {
+		t.Errorf("sale movements = %d, want %d", ledger.Sales, counts[http.StatusOK])
+	}
+}
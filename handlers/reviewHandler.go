@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shop-account/dtos"
+	"shop-account/models"
+	"shop-account/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type ReviewHandler struct {
+	DB *gorm.DB
+}
+
+var (
+	errReviewExists   = errors.New("you have already reviewed this book, edit your review instead")
+	errReviewReported = errors.New("you have already reported this review")
+	errOwnReview      = errors.New("you cannot report your own review")
+)
+
+func toReviewResponse(review models.Review) dtos.ReviewResponse {
+	return dtos.ReviewResponse{
+		ID:        review.ID,
+		BookID:    review.BookID,
+		UserID:    review.UserID,
+		Username:  review.User.Username,
+		Rating:    review.Rating,
+		Title:     review.Title,
+		Body:      review.Body,
+		Status:    string(review.Status),
+		CreatedAt: review.CreatedAt,
+		UpdatedAt: review.UpdatedAt,
+	}
+}
+
+// GetBookReviews lists the approved reviews of a book with the usual pagination, filter
+// and sort parameters, e.g. sort=highest or filter[rating][gte]=4.
+func (h *ReviewHandler) GetBookReviews(c *gin.Context) {
+	var book models.Book
+	if err := h.DB.First(&book, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	var reviews []models.Review
+	query := h.DB.Preload("User").Where("reviews.book_id = ? AND reviews.status = ?", book.ID, models.ReviewApproved).Order("reviews.created_at DESC")
+
+	response, err := utils.PaginateList(c, query, &models.Review{}, &reviews)
+	if err != nil {
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch reviews", "details": err.Error()})
+		return
+	}
+
+	reviewResponses := make([]dtos.ReviewResponse, 0, len(reviews))
+	for _, review := range reviews {
+		reviewResponses = append(reviewResponses, toReviewResponse(review))
+	}
+
+	response["reviews"] = reviewResponses
+	response["average_rating"] = book.AverageRating
+	response["review_count"] = book.ReviewCount
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateReview adds the current user's review of a book. Only users with a
+// completed order containing the book may review it, once. The moderation
+// rules decide whether it is published right away or waits for a moderator.
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var request dtos.ReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	var book models.Book
+	if err := h.DB.First(&book, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	purchased, err := utils.HasPurchasedBook(h.DB, userID, book.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check your orders"})
+		return
+	}
+	if !purchased {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only customers with a completed order for this book can review it"})
+		return
+	}
+
+	review := models.Review{
+		UserID: userID,
+		BookID: book.ID,
+		Rating: request.Rating,
+		Title:  request.Title,
+		Body:   request.Body,
+	}
+	review.Status, review.FlagReason = utils.LoadReviewModerationRules().Screen(user, review, time.Now())
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the book serialises reviews of it, so the duplicate check
+		// and the rating update cannot race.
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&models.Book{}, book.ID).Error; err != nil {
+			return err
+		}
+
+		var existing models.Review
+		err := tx.Where("user_id = ? AND book_id = ?", userID, book.ID).First(&existing).Error
+		if err == nil {
+			return errReviewExists
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		if err := utils.AdjustBookRating(tx, book.ID, 0, review.CountedRating()); err != nil {
+			return err
+		}
+
+		reason := review.FlagReason
+		if reason == "" {
+			reason = "auto-approved"
+		}
+		return tx.Create(&models.ReviewModerationLog{
+			ReviewID:      review.ID,
+			ToStatus:      review.Status,
+			ActorID:       user.ID,
+			ActorUsername: user.Username,
+			Reason:        reason,
+		}).Error
+	})
+	if err == errReviewExists {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error creating review of book %d: %v\n", book.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
+		return
+	}
+
+	h.DB.Preload("User").First(&review, review.ID)
+	message := "Review created successfully"
+	if review.Status == models.ReviewPending {
+		message = "Review submitted and waiting for moderation"
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": message,
+		"review":  toReviewResponse(review),
+	})
+}
+
+// UpdateReview lets the author of a review change it. The new text goes
+// through the moderation rules again unless a moderator already rejected or
+// hid the review, which stays as it is.
+func (h *ReviewHandler) UpdateReview(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	var request dtos.ReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var review models.Review
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ? AND user_id = ?", reviewID, userID).First(&review).Error; err != nil {
+			return err
+		}
+
+		previous := review
+		review.Rating, review.Title, review.Body = request.Rating, request.Title, request.Body
+		status, flagReason := review.Status, review.FlagReason
+		if review.Status == models.ReviewApproved || review.Status == models.ReviewPending {
+			status, flagReason = utils.LoadReviewModerationRules().Screen(user, review, time.Now())
+		}
+
+		if err := tx.Model(&review).Updates(map[string]interface{}{
+			"rating":      review.Rating,
+			"title":       review.Title,
+			"body":        review.Body,
+			"flag_reason": flagReason,
+		}).Error; err != nil {
+			return err
+		}
+		if err := utils.AdjustBookRating(tx, review.BookID, previous.CountedRating(), review.CountedRating()); err != nil {
+			return err
+		}
+
+		reason := flagReason
+		if reason == "" {
+			reason = "edited and auto-approved"
+		}
+		return utils.ChangeReviewStatus(tx, &review, status, user.ID, user.Username, reason)
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error updating review %d: %v\n", reviewID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+
+	h.DB.Preload("User").First(&review, review.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Review updated successfully",
+		"review":  toReviewResponse(review),
+	})
+}
+
+// DeleteReview lets the author of a review remove it. The review is deleted
+// for good so the user can review the book again later.
+func (h *ReviewHandler) DeleteReview(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var review models.Review
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ? AND user_id = ?", reviewID, userID).First(&review).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&review).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("review_id = ?", review.ID).Delete(&models.ReviewReport{}).Error; err != nil {
+			return err
+		}
+		return utils.AdjustBookRating(tx, review.BookID, review.CountedRating(), 0)
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error deleting review %d: %v\n", reviewID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review deleted successfully"})
+}
+
+// ReportReview lets a customer flag a review for moderators. Once a review has
+// REVIEW_REPORT_THRESHOLD reports it goes back to the moderation queue.
+func (h *ReviewHandler) ReportReview(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	var request dtos.ReviewReportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	rules := utils.LoadReviewModerationRules()
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var review models.Review
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ? AND status = ?", reviewID, models.ReviewApproved).First(&review).Error; err != nil {
+			return err
+		}
+		if review.UserID == userID {
+			return errOwnReview
+		}
+
+		var existing models.ReviewReport
+		err := tx.Where("review_id = ? AND user_id = ?", review.ID, userID).First(&existing).Error
+		if err == nil {
+			return errReviewReported
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		if err := tx.Create(&models.ReviewReport{
+			ReviewID: review.ID,
+			UserID:   userID,
+			Reason:   request.Reason,
+			Details:  request.Details,
+		}).Error; err != nil {
+			return err
+		}
+		review.ReportCount++
+		if err := tx.Model(&review).UpdateColumn("report_count", review.ReportCount).Error; err != nil {
+			return err
+		}
+
+		if review.ReportCount < rules.ReportThreshold {
+			return nil
+		}
+		reason := fmt.Sprintf("reported %d times", review.ReportCount)
+		if err := tx.Model(&review).UpdateColumn("flag_reason", reason).Error; err != nil {
+			return err
+		}
+		return utils.ChangeReviewStatus(tx, &review, models.ReviewPending, 0, "system", reason)
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if err == errReviewReported {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err == errOwnReview {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error reporting review %d: %v\n", reviewID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review reported, thank you"})
+}
@@ -1,96 +1,31 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"shop-account/models"
 	"shop-account/utils"
-	"github.com/lib/pq"
 )
 
 type TransactionHandler struct {
 	DB *gorm.DB
 }
-func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
-	userIDInterface, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
 
-	userIDFloat, ok := userIDInterface.(float64)
+// errForbidden aborts a database transaction when the row belongs to another
+// user.
+var errForbidden = errors.New("forbidden")
+// CreateTransaction checks out the current user's cart into a new pending
+// transaction. It is kept alongside POST /cart/checkout for existing clients.
+func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
+	userID, ok := currentUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
-		return
-	}
-
-	userID := uint(userIDFloat)
-
-	var purchaseRequest struct {
-		PurchaseIDs []uint `json:"purchase_ids"`
-	}
-
-	if err := c.ShouldBindJSON(&purchaseRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		return
-	}
-
-	fmt.Printf("purchaseRequest PurchaseIDs: %v\n", purchaseRequest.PurchaseIDs)
-
-	var purchases []models.Purchase
-	if err := h.DB.Preload("Book").Where("id = ANY(?) and transaction_id = 0", pq.Array(purchaseRequest.PurchaseIDs)).Find(&purchases).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve purchases"})
-		return
-	}
-
-	if len(purchases) != len(purchaseRequest.PurchaseIDs) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Some purchases not found"})
-		return
-	}
-
-	var totalAmount float64
-	for _, purchase := range purchases {
-		fmt.Printf("Quantity: %f\n", float64(purchase.Quantity))
-		fmt.Printf("BookPrice: %f\n", float64(purchase.BookPrice))
-		totalAmount += float64(purchase.Quantity) * float64(purchase.BookPrice)
-	}
-
-	fmt.Printf("totalAmount: %f\n", totalAmount)
-
-	// Generate unique code for the transaction
-	code, err := utils.GenerateCode(h.DB, &models.Transaction{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate transaction code", "details": err.Error()})
-		return
-	}
-
-	transaction := models.Transaction{
-		UserID:      userID,
-		TotalAmount: totalAmount,
-		Status:      "pending",
-		Purchases:   purchases,
-		Code:        code,  // Add the generated code to the transaction
-	}
-
-	if err := h.DB.Create(&transaction).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create a new transaction"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	for i := range purchases {
-		purchases[i].TransactionID = transaction.ID
-		if err := h.DB.Save(&purchases[i]).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase with transaction ID"})
-			return
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "A transaction is created",
-		"transaction_code": transaction.Code,  
-	})
+	checkoutCart(c, h.DB, userID)
 }
 
 func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
@@ -113,26 +48,39 @@ func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
         return
     }
 
+    // Deleting an order cancels it first, which gives its stock back and
+    // records the cancellation, and then removes it with its order lines.
     var transaction models.Transaction
-    if err := h.DB.Preload("Purchases").Preload("Purchases.Book").First(&transaction, transactionID).Error; err != nil {
+    err := h.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&transaction, transactionID).Error; err != nil {
+            return err
+        }
+        if transaction.UserID != userID {
+            return errForbidden
+        }
+
+        if err := utils.ChangeTransactionStatus(tx, &transaction, models.Cancelled, userID, c.GetString("username"), "deleted by customer"); err != nil {
+            return err
+        }
+
+        if err := tx.Where("transaction_id = ?", transaction.ID).Delete(&models.Purchase{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&transaction).Error
+    })
+    if gorm.IsRecordNotFoundError(err) {
         c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
         return
     }
-
-    if transaction.UserID != userID {
+    if err == errForbidden {
         c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this transaction"})
         return
     }
-
-    for _, purchase := range transaction.Purchases {
-        purchase.TransactionID = 0 
-        if err := h.DB.Save(&purchase).Error; err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase records"})
-            return
-        }
+    if transitionErr, ok := err.(*models.TransitionError); ok {
+        c.JSON(http.StatusConflict, gin.H{"error": transitionErr.Error(), "current_status": transitionErr.From})
+        return
     }
-
-    if err := h.DB.Delete(&transaction).Error; err != nil {
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete the transaction"})
         return
     }
@@ -192,19 +140,49 @@ func (h *TransactionHandler) GetUserTransactions(c *gin.Context) {
 	// Create a custom query to filter by user_id
 	customQuery := h.DB.Preload("Purchases").Preload("Purchases.Book").Where("user_id = ?", userID)
 
-	// Call PaginateAndSearch utility to fetch paginated data with custom query
-	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, customQuery, &models.Transaction{}, &transactions, nil)
+	// Fetch one page, in offset or cursor mode, with the custom query
+	response, err := utils.PaginateList(c, customQuery, &models.Transaction{}, &transactions)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions", "details": err.Error()})
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch transactions", "details": err.Error()})
 		return
 	}
 
 	// Returning the paginated transactions as a response
+	response["transactions"] = transactions
+	c.JSON(http.StatusOK, response)
+}
+// GetTransactionHistory returns the status changes of a transaction, oldest
+// first. Customers can only see their own transactions; users with the
+// orders:manage permission see any.
+func (h *TransactionHandler) GetTransactionHistory(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var transaction models.Transaction
+	if err := h.DB.First(&transaction, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	if transaction.UserID != userID && !utils.HasPermission(c, models.PermOrdersManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to view this transaction"})
+		return
+	}
+
+	var history []models.TransactionStatusHistory
+	if err := h.DB.Where("transaction_id = ?", transaction.ID).Order("created_at ASC, id ASC").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transaction history"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"current_page":   page,
-		"total_pages":    totalPages,
-		"total_items":    totalItems,
-		"items_per_page": c.DefaultQuery("limit", "10"),
-		"transactions":   transactions,
+		"transaction_id":   transaction.ID,
+		"transaction_code": transaction.Code,
+		"status":           transaction.Status,
+		"next_statuses":    transaction.Status.NextStatuses(),
+		"history":          history,
 	})
-}
\ No newline at end of file
+}
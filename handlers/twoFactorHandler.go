@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"shop-account/models"
+	"shop-account/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// EnrollTwoFactor creates a new TOTP secret for the current user. 2FA is not
+// active until the secret is confirmed with a code from the authenticator.
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := h.DB.Model(&user).UpdateColumns(map[string]interface{}{"two_factor_secret": secret, "last_totp_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.OTPAuthURI(utils.TwoFactorIssuer(), user.Username, secret),
+	})
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator works.
+// The recovery codes are returned only in this response.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var user models.User
+	var codes []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		user.ID = userID
+		if err := utils.VerifyTOTPForUser(tx, &user, request.Code); err != nil {
+			return err
+		}
+		if user.TwoFactorEnabled || user.TwoFactorSecret == "" {
+			return errTwoFactorState
+		}
+		if err := tx.Model(&user).UpdateColumn("two_factor_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = utils.GenerateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if !respondTwoFactorError(c, err) {
+		return
+	}
+
+	// Sessions opened with only the password no longer count as signed in.
+	if err := utils.RevokeAllSessions(h.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	h.DB.First(&user, user.ID)
+	tokens, err := utils.IssueSession(h.DB, user, true, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+		"token":          tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"expires_in":     tokens.ExpiresIn,
+	})
+}
+
+// VerifyTwoFactor finishes a two-step login: it exchanges the challenge token
+// from Login plus a TOTP or recovery code for a session.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_token and either code or recovery_code are required"})
+		return
+	}
+
+	user, challengeID, err := utils.ParseTwoFactorChallenge(h.DB, request.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = utils.CompleteTwoFactorChallenge(h.DB, challengeID, &user, request.Code, request.RecoveryCode)
+	if !respondTwoFactorError(c, err) {
+		return
+	}
+
+	tokens, err := utils.IssueSession(h.DB, user, true, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"id":            user.ID,
+		"username":      user.Username,
+		"role":          user.Role,
+		"active":        user.Active,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a code.
+// Accounts for which 2FA is mandatory cannot disable it.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var request struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password and either code or recovery_code are required"})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if utils.TwoFactorRequiredFor(&user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for this account"})
+		return
+	}
+	if !utils.ComparePasswords(user.Password, request.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	err := utils.WithSecondFactor(h.DB, &user, request.Code, request.RecoveryCode, func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).UpdateColumns(map[string]interface{}{
+			"two_factor_enabled": false,
+			"two_factor_secret":  "",
+			"last_totp_step":     0,
+		}).Error
+	})
+	if !respondTwoFactorError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes. It needs
+// a valid TOTP code so a stolen session alone cannot read new codes.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var codes []string
+	user := models.User{}
+	user.ID = userID
+	err := utils.WithSecondFactor(h.DB, &user, request.Code, "", func(tx *gorm.DB) error {
+		if !user.TwoFactorEnabled {
+			return errTwoFactorState
+		}
+		var err error
+		codes, err = utils.GenerateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if !respondTwoFactorError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// RequireTwoFactor lets an admin make 2FA mandatory for a user. Until the user
+// enrolls, their permission-protected routes answer 403.
+func (h *AuthHandler) RequireTwoFactor(c *gin.Context) {
+	var request struct {
+		Username string `json:"username" binding:"required"`
+		Required *bool  `json:"required" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Where("username = ?", request.Username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := h.DB.Model(&user).UpdateColumn("two_factor_required", *request.Required).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor requirement updated", "username": user.Username, "required": *request.Required})
+}
+
+var errTwoFactorState = errors.New("two-factor authentication is not in a state that allows this")
+
+// respondTwoFactorError writes the response for a failed 2FA step and reports
+// whether the handler may continue.
+func respondTwoFactorError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case err == utils.ErrInvalidSecondFactor, err == utils.ErrInvalidChallenge:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case err == utils.ErrTwoFactorLocked:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case err == errTwoFactorState:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case gorm.IsRecordNotFoundError(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor operation failed"})
+	}
+	return false
+}
@@ -44,6 +44,19 @@ func (h *UserHandler) Create(c *gin.Context) {
 	}
 	user.Password = hashedPassword
 
+	// 2FA is enrolled by the user and required through the 2FA endpoints.
+	user.TwoFactorEnabled = false
+	user.TwoFactorRequired = false
+	user.TwoFactorSecret = ""
+	user.LastTOTPStep = 0
+
+	code, err := utils.GenerateCode(h.DB, &models.User{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate user code"})
+		return
+	}
+	user.Code = code
+
 		// Create the user in the database
 		if err := h.DB.Create(&user).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -63,6 +76,16 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
+// Get user by code
+func (h *UserHandler) GetByCode(c *gin.Context) {
+	var user models.User
+	if err := h.DB.Where("code = ?", c.Param("code")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
 // Update user details
 func (h *UserHandler) Update(c *gin.Context) {
 	id := c.Param("id")
@@ -79,7 +102,9 @@ func (h *UserHandler) Update(c *gin.Context) {
 	}
 
 	// Update the user's information
-	if err := h.DB.Model(&existingUser).Updates(user).Error; err != nil {
+	// The code is assigned once at creation and never changes, and 2FA is
+	// only changed through the 2FA endpoints.
+	if err := h.DB.Model(&existingUser).Omit("code", "two_factor_enabled", "two_factor_required", "two_factor_secret", "last_totp_step").Updates(user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -112,7 +137,7 @@ func (h *UserHandler) List(c *gin.Context) {
 	// Call PaginateAndSearch utility to fetch paginated data with dynamic search (if any)
 	totalItems, page, totalPages, err := utils.PaginateAndSearch(c, h.DB, &models.User{}, &users, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users", "details": err.Error()})
+		c.JSON(utils.ListErrorStatus(err), gin.H{"error": "Failed to fetch users", "details": err.Error()})
 		return
 	}
 
@@ -7,6 +7,7 @@ import (
 	"shop-account/handlers"
 	"shop-account/handlers/admin"
 	"shop-account/routes"
+	"shop-account/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	_ "github.com/lib/pq"
@@ -22,6 +23,21 @@ func init() {
 		log.Fatal("Error loading .env file")
 	}
 
+	if err := utils.InitTokenService(); err != nil {
+		log.Fatal("Failed to configure token service:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.InitMailer(); err != nil {
+		log.Fatal("Failed to configure mailer:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.InitStorage(); err != nil {
+		log.Fatal("Failed to configure file storage:", err)
+		os.Exit(1)
+	}
+
 	serviceURI := os.Getenv("DATABASE_URL")
 	if serviceURI == "" {
 		log.Fatal("DATABASE_URL environment variable is not set")
@@ -39,14 +55,122 @@ func init() {
 		os.Exit(1)
 	}
 
-	if err := DB.AutoMigrate(&models.FavoriteBook{},&models.BookCategory{}, &models.Category{}, &models.Author{}, &models.Book{}, &models.User{}, &models.Purchase{}, &models.Transaction{}).Error; err != nil {
+	if err := DB.AutoMigrate(&models.FavoriteBook{},&models.BookCategory{}, &models.Category{}, &models.Author{}, &models.Publisher{}, &models.Book{}, &models.BookContributor{}, &models.User{}, &models.Purchase{}, &models.Transaction{}, &models.Cart{}, &models.CartItem{}, &models.TransactionStatusHistory{}, &models.StockMovement{}, &models.RefreshToken{}, &models.Permission{}, &models.Role{}, &models.UserToken{}, &models.RecoveryCode{}, &models.Review{}, &models.ReviewReport{}, &models.ReviewModerationLog{}, &models.BookImage{}, &models.ImageVariant{}, &models.ImportJob{}, &models.TwoFactorFailure{}).Error; err != nil {
 		log.Fatal("Failed to migrate database:", err)
 		os.Exit(1)
 	}
 
+	if err := utils.SetupBookSearch(DB); err != nil {
+		log.Fatal("Failed to set up book search:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SetupCodes(DB); err != nil {
+		log.Fatal("Failed to set up entity codes:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SetupBookContributors(DB); err != nil {
+		log.Fatal("Failed to set up book contributors:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SetupBookISBN(DB); err != nil {
+		log.Fatal("Failed to set up book ISBNs:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SetupCategoryTree(DB); err != nil {
+		log.Fatal("Failed to set up the category tree:", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SeedRolesAndPermissions(DB); err != nil {
+		log.Fatal("Failed to seed roles and permissions:", err)
+		os.Exit(1)
+	}
+
+	if err := migrateLegacyCartLines(DB); err != nil {
+		log.Fatal("Failed to migrate legacy cart lines:", err)
+		os.Exit(1)
+	}
+
+	if err := recordOpeningStockBalances(DB); err != nil {
+		log.Fatal("Failed to record opening stock balances:", err)
+		os.Exit(1)
+	}
+
 	log.Println("Successfully connected to the database")
 }
 
+// migrateLegacyCartLines moves purchases that were never attached to a
+// transaction (the old implicit cart) into real carts. Those purchases already
+// took their stock when they were created, so the stock is given back here and
+// taken again when the cart is checked out.
+func migrateLegacyCartLines(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var purchases []models.Purchase
+		if err := tx.Where("transaction_id = 0").Find(&purchases).Error; err != nil {
+			return err
+		}
+
+		for _, purchase := range purchases {
+			var cart models.Cart
+			if err := tx.Where(models.Cart{UserID: purchase.UserID}).FirstOrCreate(&cart).Error; err != nil {
+				return err
+			}
+
+			var item models.CartItem
+			err := tx.Where("cart_id = ? AND book_id = ?", cart.ID, purchase.BookID).First(&item).Error
+			if gorm.IsRecordNotFoundError(err) {
+				item = models.CartItem{CartID: cart.ID, BookID: purchase.BookID, Quantity: purchase.Quantity}
+				err = tx.Create(&item).Error
+			} else if err == nil {
+				err = tx.Model(&item).UpdateColumn("quantity", gorm.Expr("quantity + ?", purchase.Quantity)).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(&models.Book{}).Where("id = ?", purchase.BookID).UpdateColumns(map[string]interface{}{
+				"quantity_in_stock": gorm.Expr("quantity_in_stock + ?", purchase.Quantity),
+				"quantity_sold":     gorm.Expr("GREATEST(quantity_sold - ?, 0)", purchase.Quantity),
+			}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Delete(&purchase).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(purchases) > 0 {
+			log.Printf("Moved %d legacy cart purchases into carts", len(purchases))
+		}
+		return nil
+	})
+}
+
+// recordOpeningStockBalances seeds the inventory ledger for books that have
+// no stock movements yet, so the ledger sum matches their current stock.
+func recordOpeningStockBalances(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var bookIDs []uint
+		if err := tx.Unscoped().Model(&models.Book{}).
+			Where("NOT EXISTS (SELECT 1 FROM stock_movements WHERE stock_movements.book_id = books.id)").
+			Pluck("id", &bookIDs).Error; err != nil {
+			return err
+		}
+
+		for _, bookID := range bookIDs {
+			if err := utils.RecordOpeningStock(tx, bookID, utils.StockMovementRef{Reason: "opening balance"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func main() {
 	r := gin.Default()
 
@@ -65,19 +189,39 @@ func main() {
 		c.Next()
 	})
 
+	// Imports still running when the server stopped cannot be resumed
+	if err := utils.FailInterruptedImportJobs(DB); err != nil {
+		log.Printf("Failed to clean up import jobs: %v", err)
+	}
+
+	// Resized image variants are generated in the background
+	utils.StartImageWorkers(DB, 2)
+
+	// Files of the local storage driver are served by the API itself
+	if dir, publicURL, ok := utils.LocalStorageDir(); ok {
+		r.Static(publicURL, dir)
+	}
+
 	// Initialize handlers
 	authorHandler := &handlers.AuthorHandler{DB: DB}
+	publisherHandler := &handlers.PublisherHandler{DB: DB}
 	bookHandler := &handlers.BookHandler{DB: DB}
 	authHandler := &handlers.AuthHandler{DB: DB}
 	userHandler := &handlers.UserHandler{DB: DB}
 	purchaseHandler := &handlers.PurchaseHandler{DB: DB}
 	transactionHandler := &handlers.TransactionHandler{DB: DB}
 	transactionAdminHandler := &admin.AdminTransactionHandler{DB: DB}
+	inventoryAdminHandler := &admin.AdminInventoryHandler{DB: DB}
+	roleAdminHandler := &admin.AdminRoleHandler{DB: DB}
+	reviewAdminHandler := &admin.AdminReviewHandler{DB: DB}
+	bookAdminHandler := &admin.AdminBookHandler{DB: DB}
 	categoryHandler := &handlers.CategoryHandler{DB: DB}
 	favoriteHandler := &handlers.FavoriteBookHandler{DB: DB}
+	cartHandler := &handlers.CartHandler{DB: DB}
+	reviewHandler := &handlers.ReviewHandler{DB: DB}
 
 	// Set up routes
-	routes.SetupRoutes(r, favoriteHandler, categoryHandler, transactionAdminHandler, transactionHandler, purchaseHandler, userHandler, authorHandler, bookHandler, authHandler)
+	routes.SetupRoutes(r, publisherHandler, reviewHandler, cartHandler, favoriteHandler, categoryHandler, transactionAdminHandler, inventoryAdminHandler, roleAdminHandler, reviewAdminHandler, bookAdminHandler, transactionHandler, purchaseHandler, userHandler, authorHandler, bookHandler, authHandler)
 
 	// Start the server
 	if err := r.Run(":8080"); err != nil {
@@ -2,66 +2,109 @@ package middlewares
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 	"net/http"
-	"strings"
-	"github.com/dgrijalva/jwt-go"
-	// "fmt"
+	"shop-account/models"
+	"shop-account/utils"
 )
 
+// authenticateRequest validates the bearer token of the request with the
+// application's token service and checks it has not been revoked.
+func authenticateRequest(c *gin.Context, db *gorm.DB) (*models.User, string, bool, error) {
+	tokenString, err := utils.ExtractBearerToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return nil, "", false, err
+	}
+	claims, err := utils.Tokens.ParseToken(tokenString)
+	if err != nil {
+		return nil, "", false, err
+	}
+	user, err := utils.AuthenticateAccessClaims(db, claims)
+	if err != nil {
+		return nil, "", false, err
+	}
+	sessionID, _ := claims["sid"].(string)
+	mfa, _ := claims["mfa"].(bool)
+	return user, sessionID, mfa, nil
+}
+
+// setAuthContext stores the authenticated user and the permissions of their
+// role in the context. user_id stays a float64, as handlers have always read
+// it from the JWT claims.
+func setAuthContext(c *gin.Context, db *gorm.DB, user *models.User, sessionID string, mfa bool) error {
+	permissions, err := utils.RolePermissions(db, user.Role)
+	if err != nil {
+		return err
+	}
+	c.Set("username", user.Username)
+	c.Set("user_id", float64(user.ID))
+	c.Set("role", user.Role)
+	c.Set("permissions", permissions)
+	c.Set("session_id", sessionID)
+	c.Set("mfa", mfa)
+	return nil
+}
+
 // Middleware để kiểm tra JWT token
-	func AuthMiddleware() gin.HandlerFunc {
+	func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 		return func(c *gin.Context) {
-			authHeader := c.GetHeader("Authorization")
-			if authHeader == "" {
+			if c.GetHeader("Authorization") == "" {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 				c.Abort()
 				return
 			}
 
-			tokenString := strings.Split(authHeader, " ")[1]
-
-			claims := jwt.MapClaims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				return []byte("your_secret_key"), nil
-			})
-
-			if err != nil || !token.Valid {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			user, sessionID, mfa, err := authenticateRequest(c, db)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
 				c.Abort()
 				return
 			}
-			// fmt.Printf("claims: %s", claims)
 
-			c.Set("username", claims["username"])
-			c.Set("user_id", claims["user_id"])
+			if err := setAuthContext(c, db, user, sessionID, mfa); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+				c.Abort()
+				return
+			}
 			c.Next()
 		}
 	}
 
 
-func AuthMiddlewareForRole(requiredRole string) gin.HandlerFunc {
+// RequirePermission authenticates the request and lets it through only if the
+// user's role grants permission. The role is read from the database, not the
+// token, so a role change applies to tokens issued before it. Accounts that
+// must use 2FA need a session that passed the second factor.
+func RequirePermission(db *gorm.DB, permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		// Recorded before authenticating, so it is known even for rejected
+		// requests (logging, the route permission test).
+		c.Set("required_permission", permission)
+		if c.GetHeader("Authorization") == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 			c.Abort()
 			return
 		}
 
-		tokenString := strings.Split(authHeader, " ")[1]
-
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your_secret_key"), nil
-		})
+		user, sessionID, mfa, err := authenticateRequest(c, db)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+			c.Abort()
+			return
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		if err := setAuthContext(c, db, user, sessionID, mfa); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			c.Abort()
+			return
+		}
+		if utils.TwoFactorRequiredFor(user) && !mfa {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for this account"})
 			c.Abort()
 			return
 		}
-		if claims["role"] != requiredRole {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		if !utils.HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "required_permission": permission})
 			c.Abort()
 			return
 		}
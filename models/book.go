@@ -2,16 +2,55 @@ package models
 
 import "github.com/jinzhu/gorm"
 
+// BookFormat is the physical or digital form of an edition.
+type BookFormat string
+
+const (
+    FormatHardcover BookFormat = "hardcover"
+    FormatPaperback BookFormat = "paperback"
+    FormatEbook     BookFormat = "ebook"
+)
+
+func (f BookFormat) IsValid() bool {
+    switch f {
+    case FormatHardcover, FormatPaperback, FormatEbook:
+        return true
+    }
+    return false
+}
+
 type Book struct {
     gorm.Model
     Title          string  `json:"title"`
     Description    string  `json:"description"`
     Price          float64 `json:"price" gorm:"default:0"` 
+    // AuthorID and Author are the primary author, the first contributor with
+    // the author role; Contributors lists everyone who worked on the book.
     AuthorID       uint    `json:"author_id"`
     Author         Author  `json:"author"`
+    Contributors   []BookContributor `json:"contributors,omitempty"`
     Active         bool    `json:"active" gorm:"default:true"`
     QuantityInStock uint   `json:"quantity_in_stock" gorm:"default:10"` 
     QuantitySold   uint    `json:"quantity_sold" gorm:"default:0"` 
+    AverageRating  float64 `json:"average_rating" gorm:"default:0"`
+    ReviewCount    uint    `json:"review_count" gorm:"default:0"`
     Categories     []Category `gorm:"many2many:book_categories;foreignkey:ID;association_foreignkey:ID" json:"categories"`
      Code        string `json:"code"`
+    // ISBN is the ISBN-13 of the edition; ISBN10 is derived from it when the
+    // ISBN has one (978 prefix).
+    ISBN           string  `json:"isbn" gorm:"index"`
+    ISBN10         string  `json:"isbn10"`
+    PublisherID    *uint   `json:"publisher_id"`
+    Publisher      *Publisher `json:"publisher,omitempty"`
+    PublishedAt    *Date   `json:"published_at" gorm:"type:date"`
+    PageCount      uint    `json:"page_count"`
+    // Language is a lower-case language tag such as "vi" or "en-us".
+    Language       string  `json:"language"`
+    Format         BookFormat `json:"format"`
+    Edition        string  `json:"edition"`
+    CoverURL       string  `json:"cover_url"`
+    // CoverKey identifies the stored cover file so it can be deleted.
+    CoverKey       string  `json:"-"`
+    CoverVariants  *ResponsiveImage `json:"cover_variants,omitempty" gorm:"-"`
+    Images         []BookImage `json:"images,omitempty"`
 }
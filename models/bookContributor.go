@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ContributorRole is what a person did for a book.
+type ContributorRole string
+
+const (
+    RoleAuthor      ContributorRole = "author"
+    RoleTranslator  ContributorRole = "translator"
+    RoleIllustrator ContributorRole = "illustrator"
+    RoleEditor      ContributorRole = "editor"
+)
+
+// ContributorRoles lists the roles in the order they are shown.
+var ContributorRoles = []ContributorRole{RoleAuthor, RoleTranslator, RoleIllustrator, RoleEditor}
+
+func (r ContributorRole) IsValid() bool {
+    for _, role := range ContributorRoles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+// BookContributor links a book to an author (any contributor is stored as an
+// Author) with a role. Position orders the contributors of a book; the first
+// one with the author role is the book's primary author, mirrored in
+// Book.AuthorID for older clients.
+type BookContributor struct {
+    ID        uint            `json:"id" gorm:"primary_key"`
+    BookID    uint            `json:"book_id" gorm:"unique_index:idx_book_contributor"`
+    AuthorID  uint            `json:"author_id" gorm:"unique_index:idx_book_contributor;index"`
+    Role      ContributorRole `json:"role" gorm:"unique_index:idx_book_contributor"`
+    Position  int             `json:"position"`
+    Author    Author          `json:"author"`
+    CreatedAt time.Time       `json:"created_at"`
+    UpdatedAt time.Time       `json:"updated_at"`
+}
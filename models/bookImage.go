@@ -0,0 +1,18 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// BookImage is one picture of a book's gallery, shown in Position order.
+type BookImage struct {
+    gorm.Model
+    BookID      uint   `json:"book_id" gorm:"index"`
+    URL         string `json:"url"`
+    // StorageKey identifies the stored file so it can be deleted.
+    StorageKey  string `json:"-"`
+    ContentType string `json:"content_type"`
+    Width       int    `json:"width"`
+    Height      int    `json:"height"`
+    Size        int64  `json:"size"`
+    Position    int    `json:"position"`
+    Variants    *ResponsiveImage `json:"variants,omitempty" gorm:"-"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// Cart is the single open shopping cart of a user. Items are only turned into
+// Purchase rows when the cart is checked out.
+type Cart struct {
+    gorm.Model
+    UserID uint       `json:"user_id" gorm:"unique_index"`
+    Items  []CartItem `json:"items"`
+}
+
+// CartItem is one line of a cart. A cart holds at most one line per book;
+// adding the same book again increases the quantity of the existing line.
+type CartItem struct {
+    gorm.Model
+    CartID   uint `json:"cart_id" gorm:"unique_index:idx_cart_items_cart_book"`
+    BookID   uint `json:"book_id" gorm:"unique_index:idx_cart_items_cart_book"`
+    Book     Book `json:"book"`
+    Quantity uint `json:"quantity" gorm:"default:1"`
+}
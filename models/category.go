@@ -1,11 +1,41 @@
 package models
 
-import "github.com/jinzhu/gorm"
+import (
+    "fmt"
+
+    "github.com/jinzhu/gorm"
+)
 
 type Category struct {
     gorm.Model
     Name        string `json:"name"` 
     Description string `json:"description"`
     ImageURL    string `json:"image_url"`
+    // ImageKey identifies the stored image so it can be deleted when replaced.
+    ImageKey    string `json:"-"`
+    ImageVariants *ResponsiveImage `json:"image_variants,omitempty" gorm:"-"`
      Code        string `json:"code"`
+    // ParentID is nil for top-level categories. Path lists the IDs from the
+    // root down to the category, e.g. "/1/5/12/", so a subtree is every
+    // category whose path starts with its path. Depth is 0 at the top.
+    ParentID    *uint  `json:"parent_id" gorm:"index"`
+    Path        string `json:"path"`
+    Depth       int    `json:"depth"`
+}
+
+// ChildPath returns the path of a category with ID id placed under c.
+func (c *Category) ChildPath(id uint) string {
+    return fmt.Sprintf("%s%d/", c.Path, id)
+}
+
+// AfterCreate fills in the path and depth, which need the new ID.
+func (c *Category) AfterCreate(tx *gorm.DB) error {
+    parent := Category{Path: "/", Depth: -1}
+    if c.ParentID != nil {
+        if err := tx.First(&parent, *c.ParentID).Error; err != nil {
+            return err
+        }
+    }
+    c.Path, c.Depth = parent.ChildPath(c.ID), parent.Depth+1
+    return tx.Model(c).UpdateColumns(map[string]interface{}{"path": c.Path, "depth": c.Depth}).Error
 }
@@ -0,0 +1,58 @@
+package models
+
+import (
+    "database/sql/driver"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// DateLayout is the format of Date in JSON, e.g. "2021-09-30".
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date without a time of day, stored in a DATE column and
+// written as "YYYY-MM-DD" in JSON.
+type Date struct {
+    time.Time
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+    return []byte(`"` + d.Format(DateLayout) + `"`), nil
+}
+
+// UnmarshalJSON reads "" as the zero Date, which callers treat as no date.
+func (d *Date) UnmarshalJSON(data []byte) error {
+    text := strings.Trim(string(data), `"`)
+    if text == "" {
+        d.Time = time.Time{}
+        return nil
+    }
+    parsed, err := time.Parse(DateLayout, text)
+    if err != nil {
+        return fmt.Errorf("dates must be formatted as YYYY-MM-DD, got %s", data)
+    }
+    d.Time = parsed
+    return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+    return d.Format(DateLayout), nil
+}
+
+func (d *Date) Scan(value interface{}) error {
+    switch v := value.(type) {
+    case time.Time:
+        d.Time = v
+    case string:
+        parsed, err := time.Parse(DateLayout, v[:min(len(v), len(DateLayout))])
+        if err != nil {
+            return err
+        }
+        d.Time = parsed
+    case []byte:
+        return d.Scan(string(v))
+    default:
+        return fmt.Errorf("cannot scan %T into Date", value)
+    }
+    return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// ImageVariant is a resized copy of a stored image (a category image, book
+// cover or gallery image), identified by the storage key of the original.
+type ImageVariant struct {
+    gorm.Model
+    SourceKey  string `json:"-" gorm:"unique_index:idx_image_variants_source_name"`
+    Name       string `json:"name" gorm:"unique_index:idx_image_variants_source_name"`
+    URL        string `json:"url"`
+    StorageKey string `json:"-"`
+    Width      int    `json:"width"`
+    Height     int    `json:"height"`
+}
+
+// ResponsiveImage lists the variants of an image by name, e.g. "thumbnail",
+// with Srcset ready for an <img srcset> attribute. Variants that are not
+// generated yet point at the original image and are left out of Srcset.
+type ResponsiveImage struct {
+    Variants map[string]string `json:"variants"`
+    Srcset   string            `json:"srcset"`
+}
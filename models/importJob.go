@@ -0,0 +1,32 @@
+package models
+
+import (
+    "time"
+    "github.com/jinzhu/gorm"
+)
+
+type ImportJobStatus string
+
+const (
+    ImportQueued    ImportJobStatus = "queued"
+    ImportRunning   ImportJobStatus = "running"
+    ImportCompleted ImportJobStatus = "completed"
+    ImportFailed    ImportJobStatus = "failed"
+)
+
+// ImportJob tracks a bulk import running in the background, so clients can
+// poll its progress and read the report when it is done.
+type ImportJob struct {
+    gorm.Model
+    Kind          string          `json:"kind"`
+    Status        ImportJobStatus `json:"status"`
+    DryRun        bool            `json:"dry_run"`
+    FileName      string          `json:"file_name"`
+    TotalRows     int             `json:"total_rows"`
+    ProcessedRows int             `json:"processed_rows"`
+    // Report is the JSON encoded report, set when the job completes.
+    Report        string          `json:"-" gorm:"type:text"`
+    Error         string          `json:"error"`
+    ActorID       uint            `json:"actor_id"`
+    FinishedAt    *time.Time      `json:"finished_at"`
+}
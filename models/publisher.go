@@ -0,0 +1,13 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+type Publisher struct {
+    gorm.Model
+    Name    string `json:"name"`
+    Country string `json:"country"`
+    Website string `json:"website"`
+    Books   []Book `json:"books,omitempty"`
+    Active  bool   `json:"active" gorm:"default:true"`
+    Code    string `json:"code"`
+}
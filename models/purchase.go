@@ -10,7 +10,7 @@ type Purchase struct {
     User        User    `json:"user"`
     Book        Book    `json:"book"`
     TransactionID uint   `json:"transaction_id"` 
-    BookPrice   float64 `json:"book_price" gorm:"default:1`     
+    BookPrice   float64 `json:"book_price" gorm:"default:1"`     
     Transaction Transaction `json:"transaction"`    
      Code        string `json:"code"`
 }
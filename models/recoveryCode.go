@@ -0,0 +1,15 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// RecoveryCode is a single-use code that can replace a TOTP code when the
+// user has lost their authenticator. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"user_id" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"index"`
+	UsedAt   *time.Time `json:"used_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+    "time"
+    "github.com/jinzhu/gorm"
+)
+
+// RefreshToken is one server-side refresh token. Only the SHA-256 hash of the
+// token is stored. Tokens are rotated on every use: the used token is revoked
+// and points at its replacement, and all tokens issued from one login share a
+// FamilyID, which is also the session ID carried by access tokens.
+type RefreshToken struct {
+    gorm.Model
+    UserID       uint       `json:"user_id" gorm:"index"`
+    TokenHash    string     `json:"-" gorm:"unique_index"`
+    FamilyID     string     `json:"family_id" gorm:"index"`
+    ExpiresAt    time.Time  `json:"expires_at"`
+    RevokedAt    *time.Time `json:"revoked_at"`
+    ReplacedByID *uint      `json:"replaced_by_id"`
+    // MFA records that the session was started with a second factor, so
+    // rotated access tokens keep the mfa claim.
+    MFA          bool       `json:"mfa" gorm:"default:false"`
+    UserAgent    string     `json:"user_agent"`
+    IPAddress    string     `json:"ip_address"`
+}
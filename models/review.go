@@ -0,0 +1,70 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+type ReviewStatus string
+
+const (
+    ReviewPending  ReviewStatus = "pending"
+    ReviewApproved ReviewStatus = "approved"
+    ReviewRejected ReviewStatus = "rejected"
+    ReviewHidden   ReviewStatus = "hidden"
+)
+
+// IsValid reports whether s is one of the known review statuses.
+func (s ReviewStatus) IsValid() bool {
+    switch s {
+    case ReviewPending, ReviewApproved, ReviewRejected, ReviewHidden:
+        return true
+    }
+    return false
+}
+
+// Review is a customer's rating of a book they bought. A user has at most one
+// review per book. Only approved reviews are shown publicly and counted in
+// Book.AverageRating and Book.ReviewCount, which utils.AdjustBookRating keeps
+// in sync.
+type Review struct {
+    gorm.Model
+    UserID      uint         `json:"user_id" gorm:"unique_index:idx_reviews_user_book"`
+    User        User         `json:"-"`
+    BookID      uint         `json:"book_id" gorm:"unique_index:idx_reviews_user_book;index"`
+    Book        Book         `json:"-"`
+    Rating      int          `json:"rating"`
+    Title       string       `json:"title"`
+    Body        string       `json:"body" gorm:"type:text"`
+    Status      ReviewStatus `json:"status" gorm:"default:'approved';index"`
+    // FlagReason says why the moderation rules held the review back.
+    FlagReason  string       `json:"flag_reason"`
+    ReportCount uint         `json:"report_count" gorm:"default:0"`
+}
+
+// CountedRating is the rating the review contributes to its book: its rating
+// when approved, 0 otherwise.
+func (r Review) CountedRating() int {
+    if r.Status == ReviewApproved {
+        return r.Rating
+    }
+    return 0
+}
+
+// ReviewReport is a customer's complaint about a review.
+type ReviewReport struct {
+    gorm.Model
+    ReviewID uint   `json:"review_id" gorm:"unique_index:idx_review_reports_review_user"`
+    UserID   uint   `json:"user_id" gorm:"unique_index:idx_review_reports_review_user"`
+    Reason   string `json:"reason"`
+    Details  string `json:"details"`
+}
+
+// ReviewModerationLog records one status change of a review: who made it
+// (ActorID 0 for the automatic rules), when (CreatedAt) and why.
+type ReviewModerationLog struct {
+    gorm.Model
+    ReviewID      uint         `json:"review_id" gorm:"index"`
+    FromStatus    ReviewStatus `json:"from_status"`
+    ToStatus      ReviewStatus `json:"to_status"`
+    ActorID       uint         `json:"actor_id"`
+    ActorUsername string       `json:"actor_username"`
+    Reason        string       `json:"reason"`
+}
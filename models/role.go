@@ -0,0 +1,57 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// Permission names checked by middlewares.RequirePermission.
+const (
+    PermBooksWrite      = "books:write"
+    PermAuthorsWrite    = "authors:write"
+    PermPublishersWrite = "publishers:write"
+    PermCategoriesWrite = "categories:write"
+    PermOrdersPlace     = "orders:place"
+    PermOrdersManage    = "orders:manage"
+    PermInventoryManage = "inventory:manage"
+    PermFavoritesWrite  = "favorites:write"
+    PermUsersAdmin      = "users:admin"
+    PermReviewsModerate = "reviews:moderate"
+)
+
+// AllPermissions lists every permission with a short description. The admin
+// role is always granted all of them.
+var AllPermissions = map[string]string{
+    PermBooksWrite:      "Create, update and delete books",
+    PermAuthorsWrite:    "Create, update and delete authors",
+    PermPublishersWrite: "Create, update and delete publishers",
+    PermCategoriesWrite: "Create, update and delete categories",
+    PermOrdersPlace:     "Use the cart, place and manage own orders",
+    PermOrdersManage:    "View all orders and change their status",
+    PermInventoryManage: "View the stock ledger and post stock movements",
+    PermFavoritesWrite:  "Manage own favorite books",
+    PermUsersAdmin:      "Manage users, roles and permissions",
+    PermReviewsModerate: "Approve, reject and hide reviews",
+}
+
+// DefaultRolePermissions are the roles created on first start. User.Role holds
+// the role name; "guest" is the role given to newly registered users.
+var DefaultRolePermissions = map[string][]string{
+    "guest": {PermOrdersPlace, PermFavoritesWrite},
+    "staff": {
+        PermBooksWrite, PermAuthorsWrite, PermPublishersWrite, PermCategoriesWrite,
+        PermOrdersPlace, PermOrdersManage, PermInventoryManage, PermFavoritesWrite,
+        PermReviewsModerate,
+    },
+    "admin": {},
+}
+
+type Permission struct {
+    gorm.Model
+    Name        string `json:"name" gorm:"unique_index"`
+    Description string `json:"description"`
+}
+
+type Role struct {
+    gorm.Model
+    Name        string       `json:"name" gorm:"unique_index"`
+    Description string       `json:"description"`
+    Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+}
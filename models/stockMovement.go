@@ -0,0 +1,28 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+type StockMovementType string
+
+const (
+    MovementReceipt      StockMovementType = "receipt"
+    MovementSale         StockMovementType = "sale"
+    MovementReturn       StockMovementType = "return"
+    MovementAdjustment   StockMovementType = "adjustment"
+    MovementCancellation StockMovementType = "cancellation"
+)
+
+// StockMovement is one entry of the inventory ledger. Every change to
+// Book.QuantityInStock is recorded as a movement, so the sum of QuantityDelta
+// for a book must always equal its current stock.
+type StockMovement struct {
+    gorm.Model
+    BookID        uint              `json:"book_id" gorm:"index"`
+    Type          StockMovementType `json:"type"`
+    QuantityDelta int               `json:"quantity_delta"`
+    StockAfter    uint              `json:"stock_after"`
+    Reference     string            `json:"reference"`
+    ActorID       uint              `json:"actor_id"`
+    ActorUsername string            `json:"actor_username"`
+    Reason        string            `json:"reason"`
+}
@@ -25,6 +25,8 @@
 package models
 
 import (
+    "fmt"
+    "strings"
     "time"
     "github.com/jinzhu/gorm"
 )
@@ -34,10 +36,67 @@ type TransactionStatus string
 const (
     Pending   TransactionStatus = "pending"
     Approved  TransactionStatus = "approved"
+    Shipped   TransactionStatus = "shipped"
     Rejected  TransactionStatus = "rejected"
+    Cancelled TransactionStatus = "cancelled"
     Completed TransactionStatus = "completed"
 )
 
+// transactionTransitions lists, for every status, the statuses an order may
+// move to next. Statuses without an entry are final.
+var transactionTransitions = map[TransactionStatus][]TransactionStatus{
+    Pending:  {Approved, Rejected, Cancelled},
+    Approved: {Shipped, Cancelled},
+    Shipped:  {Completed},
+}
+
+// IsValid reports whether s is one of the known transaction statuses.
+func (s TransactionStatus) IsValid() bool {
+    switch s {
+    case Pending, Approved, Shipped, Rejected, Cancelled, Completed:
+        return true
+    }
+    return false
+}
+
+// NextStatuses returns the statuses a transaction in status s may move to.
+func (s TransactionStatus) NextStatuses() []TransactionStatus {
+    next := transactionTransitions[s]
+    if next == nil {
+        return []TransactionStatus{}
+    }
+    return next
+}
+
+// CanTransitionTo reports whether the transition table allows s -> next.
+func (s TransactionStatus) CanTransitionTo(next TransactionStatus) bool {
+    for _, allowed := range transactionTransitions[s] {
+        if allowed == next {
+            return true
+        }
+    }
+    return false
+}
+
+// TransitionError is returned when a status change is not in the transition
+// table.
+type TransitionError struct {
+    From TransactionStatus
+    To   TransactionStatus
+}
+
+func (e *TransitionError) Error() string {
+    next := e.From.NextStatuses()
+    if len(next) == 0 {
+        return fmt.Sprintf("transaction is %s, which is a final status and cannot change to %s", e.From, e.To)
+    }
+    var names []string
+    for _, status := range next {
+        names = append(names, string(status))
+    }
+    return fmt.Sprintf("cannot change transaction status from %s to %s, allowed next statuses: %s", e.From, e.To, strings.Join(names, ", "))
+}
+
 type Transaction struct {
     gorm.Model
     UserID          uint               `json:"user_id"`
@@ -55,3 +114,14 @@ func (t *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
     }
     return nil
 }
+
+// TransitionTo moves the transaction to next if the transition table allows
+// it. The caller is responsible for saving the transaction and recording the
+// change in TransactionStatusHistory.
+func (t *Transaction) TransitionTo(next TransactionStatus) error {
+    if !t.Status.CanTransitionTo(next) {
+        return &TransitionError{From: t.Status, To: next}
+    }
+    t.Status = next
+    return nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// TransactionStatusHistory records one status change of a transaction: who
+// made it, when (CreatedAt) and why.
+type TransactionStatusHistory struct {
+    gorm.Model
+    TransactionID uint              `json:"transaction_id" gorm:"index"`
+    FromStatus    TransactionStatus `json:"from_status"`
+    ToStatus      TransactionStatus `json:"to_status"`
+    ActorID       uint              `json:"actor_id"`
+    ActorUsername string            `json:"actor_username"`
+    Reason        string            `json:"reason"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "github.com/jinzhu/gorm"
+
+// TwoFactorFailure records one wrong two-factor code sent by a user, at login
+// or from a signed-in session. Recent failures lock the user out of
+// two-factor checks for a while.
+type TwoFactorFailure struct {
+	gorm.Model
+	UserID uint `json:"user_id" gorm:"index"`
+}
@@ -1,13 +1,31 @@
 package models
 
-import "github.com/jinzhu/gorm"
+import (
+	"time"
+	"github.com/jinzhu/gorm"
+)
 
 // User struct represents the user model with an active field.
 type User struct {
 	gorm.Model
 	Username string `json:"username" binding:"required,min=3,max=30"`
 	Password string `json:"password" binding:"required,min=6"`
+	Email    string `json:"email" binding:"omitempty,email" gorm:"index"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 	Role     string `json:"role"`
 	Active   bool   `json:"active" gorm:"default:false"`
 	Code        string `json:"code"` 
+	// TokenVersion is embedded in access tokens; bumping it invalidates
+	// every access token issued before (logout from all devices).
+	TokenVersion uint `json:"-" gorm:"default:0"`
+	// TwoFactorSecret is the TOTP secret; it is set at enrollment and only
+	// used once TwoFactorEnabled is true.
+	TwoFactorSecret   string `json:"-"`
+	TwoFactorEnabled  bool   `json:"two_factor_enabled" gorm:"default:false"`
+	// TwoFactorRequired is set by an admin to make 2FA mandatory for the
+	// account; see also TWO_FACTOR_REQUIRED_ROLES.
+	TwoFactorRequired bool   `json:"two_factor_required" gorm:"default:false"`
+	// LastTOTPStep is the time step of the last accepted code, so a code
+	// cannot be replayed within its validity window.
+	LastTOTPStep      int64  `json:"-" gorm:"default:0"`
 }
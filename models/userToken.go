@@ -0,0 +1,29 @@
+package models
+
+import (
+    "time"
+    "github.com/jinzhu/gorm"
+)
+
+type UserTokenPurpose string
+
+const (
+    EmailVerification UserTokenPurpose = "email_verification"
+    PasswordReset     UserTokenPurpose = "password_reset"
+    // TwoFactorChallenge tokens are not mailed: they back the challenge
+    // token of a two-step login, so each challenge can be used only once.
+    TwoFactorChallenge UserTokenPurpose = "two_factor_challenge"
+)
+
+// UserToken is a single-use token mailed to a user. Only the SHA-256 hash of
+// the token is stored.
+type UserToken struct {
+    gorm.Model
+    UserID    uint             `json:"user_id" gorm:"index"`
+    Purpose   UserTokenPurpose `json:"purpose"`
+    TokenHash string           `json:"-" gorm:"unique_index"`
+    ExpiresAt time.Time        `json:"expires_at"`
+    UsedAt    *time.Time       `json:"used_at"`
+    // FailedAttempts counts wrong codes sent with a two-factor challenge.
+    FailedAttempts uint        `json:"-" gorm:"default:0"`
+}
@@ -2,18 +2,36 @@ package routes
 
 import (
 	"shop-account/handlers/admin"
-	// "shop-account/middlewares"
+	"shop-account/middlewares"
+	"shop-account/models"
 	"github.com/gin-gonic/gin"
 
 )
 
-func AdminRoutes(router *gin.Engine, adminTransactionHandler *admin.AdminTransactionHandler) {
+func AdminRoutes(router *gin.Engine, adminTransactionHandler *admin.AdminTransactionHandler, adminInventoryHandler *admin.AdminInventoryHandler, adminRoleHandler *admin.AdminRoleHandler, adminReviewHandler *admin.AdminReviewHandler, adminBookHandler *admin.AdminBookHandler) {
 	adminGroup := router.Group("/admin")
-    // adminGroup.Use(middlewares.AuthMiddlewareForRole("admin"))
+	ordersManage := middlewares.RequirePermission(adminTransactionHandler.DB, models.PermOrdersManage)
+	inventoryManage := middlewares.RequirePermission(adminInventoryHandler.DB, models.PermInventoryManage)
+	usersAdmin := middlewares.RequirePermission(adminRoleHandler.DB, models.PermUsersAdmin)
+	reviewsModerate := middlewares.RequirePermission(adminReviewHandler.DB, models.PermReviewsModerate)
+	booksWrite := middlewares.RequirePermission(adminBookHandler.DB, models.PermBooksWrite)
 
 	{
-		adminGroup.GET("/transactions", adminTransactionHandler.GetAllTransactions)
-		adminGroup.PATCH("/transactions/:id/status", adminTransactionHandler.UpdateTransactionStatus)
+		adminGroup.GET("/transactions", ordersManage, adminTransactionHandler.GetAllTransactions)
+		adminGroup.GET("/transactions/code/:code", ordersManage, adminTransactionHandler.GetTransactionByCode)
+		adminGroup.PATCH("/transactions/:id/status", ordersManage, adminTransactionHandler.UpdateTransactionStatus)
+		adminGroup.GET("/inventory/reconcile", inventoryManage, adminInventoryHandler.ReconcileStock)
+		adminGroup.GET("/books/:id/stock-movements", inventoryManage, adminInventoryHandler.ListStockMovements)
+		adminGroup.POST("/books/:id/stock-movements", inventoryManage, adminInventoryHandler.CreateStockMovement)
+		adminGroup.GET("/roles", usersAdmin, adminRoleHandler.GetRoles)
+		adminGroup.POST("/roles", usersAdmin, adminRoleHandler.CreateRole)
+		adminGroup.PUT("/roles/:name/permissions", usersAdmin, adminRoleHandler.UpdateRolePermissions)
+		adminGroup.GET("/permissions", usersAdmin, adminRoleHandler.GetPermissions)
+		adminGroup.GET("/reviews", reviewsModerate, adminReviewHandler.GetModerationQueue)
+		adminGroup.GET("/reviews/:id", reviewsModerate, adminReviewHandler.GetReview)
+		adminGroup.PATCH("/reviews/:id/status", reviewsModerate, adminReviewHandler.UpdateReviewStatus)
+		adminGroup.POST("/books/import", booksWrite, adminBookHandler.ImportBooks)
+		adminGroup.GET("/books/import/:job_id", booksWrite, adminBookHandler.GetImportJob)
+		adminGroup.GET("/books/export", booksWrite, adminBookHandler.ExportBooks)
 	}
 }
-
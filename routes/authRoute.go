@@ -3,16 +3,33 @@ package routes
 import (
 	"shop-account/handlers"
 	"shop-account/middlewares"
+	"shop-account/models"
 	"github.com/gin-gonic/gin"
 )
 
 func AuthRoutes(router *gin.Engine, authHandler *handlers.AuthHandler) {
 	authGroup := router.Group("/auth")
+	usersAdmin := middlewares.RequirePermission(authHandler.DB, models.PermUsersAdmin)
 	{
 	authGroup.POST("/register", authHandler.Register)
 	authGroup.POST("/login", authHandler.Login)
-	authGroup.POST("/active", authHandler.ActivateUser)
+	authGroup.POST("/refresh", authHandler.Refresh)
+	authGroup.POST("/verify-email", authHandler.VerifyEmail)
+	authGroup.POST("/resend-verification", authHandler.ResendVerification)
+	authGroup.POST("/forgot-password", authHandler.ForgotPassword)
+	authGroup.POST("/reset-password", authHandler.ResetPassword)
+	authGroup.POST("/logout", middlewares.AuthMiddleware(authHandler.DB), authHandler.Logout)
+	authGroup.POST("/logout-all", middlewares.AuthMiddleware(authHandler.DB), authHandler.LogoutAll)
 
-	authGroup.PUT("/update-role", middlewares.AuthMiddlewareForRole("admin"), authHandler.UpdateRole)
+	authGroup.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+	authGroup.POST("/2fa/enroll", middlewares.AuthMiddleware(authHandler.DB), authHandler.EnrollTwoFactor)
+	authGroup.POST("/2fa/confirm", middlewares.AuthMiddleware(authHandler.DB), authHandler.ConfirmTwoFactor)
+	authGroup.POST("/2fa/disable", middlewares.AuthMiddleware(authHandler.DB), authHandler.DisableTwoFactor)
+	authGroup.POST("/2fa/recovery-codes", middlewares.AuthMiddleware(authHandler.DB), authHandler.RegenerateRecoveryCodes)
+
+	authGroup.POST("/active", usersAdmin, authHandler.ActivateUser)
+	authGroup.POST("/deactivate", usersAdmin, authHandler.DeactivateUser)
+	authGroup.PUT("/update-role", usersAdmin, authHandler.UpdateRole)
+	authGroup.PUT("/2fa/require", usersAdmin, authHandler.RequireTwoFactor)
 	}
 }
@@ -2,20 +2,22 @@ package routes
 
 import (
 	"shop-account/handlers"
-	// "shop-account/middlewares"
+	"shop-account/middlewares"
+	"shop-account/models"
 	"github.com/gin-gonic/gin"
 )
 
 // AuthorRoutes đăng ký các route cho Author
 func AuthorRoutes(router *gin.Engine, authorHandler *handlers.AuthorHandler) {
 	authorGroup := router.Group("/authors")
-	// authorGroup.Use(middlewares.AuthMiddleware())
+	authorsWrite := middlewares.RequirePermission(authorHandler.DB, models.PermAuthorsWrite)
 	{
 		authorGroup.GET("/", authorHandler.GetAuthors)
 		authorGroup.GET("/:id", authorHandler.GetAuthorByID)
-		authorGroup.POST("/", authorHandler.CreateAuthor)
-		authorGroup.PUT("/:id", authorHandler.UpdateAuthor)
-		authorGroup.PATCH("/:id", authorHandler.PatchAuthor) // Thêm PATCH nếu cần
-		authorGroup.DELETE("/:id", authorHandler.DeleteAuthor)
+		authorGroup.GET("/code/:code", authorHandler.GetAuthorByCode)
+		authorGroup.POST("/", authorsWrite, authorHandler.CreateAuthor)
+		authorGroup.PUT("/:id", authorsWrite, authorHandler.UpdateAuthor)
+		authorGroup.PATCH("/:id", authorsWrite, authorHandler.PatchAuthor) // Thêm PATCH nếu cần
+		authorGroup.DELETE("/:id", authorsWrite, authorHandler.DeleteAuthor)
 	}
 }
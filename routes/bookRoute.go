@@ -3,23 +3,33 @@ package routes
 import (
 	"shop-account/handlers"
 	"shop-account/middlewares"
+	"shop-account/models"
 	"github.com/gin-gonic/gin"
 )
 
 // BookRoutes đăng ký các route cho sách
 func BookRoutes(router *gin.Engine, bookHandler *handlers.BookHandler) {
 	bookGroup := router.Group("/books")
-	bookGroup.Use(middlewares.SetUserIDMiddleware())
+	bookGroup.Use(middlewares.SetUserIDMiddleware(bookHandler.DB))
+	booksWrite := middlewares.RequirePermission(bookHandler.DB, models.PermBooksWrite)
 	{
 		bookGroup.GET("/", bookHandler.GetBooks)
+		bookGroup.GET("/search", bookHandler.SearchBooks)
 		bookGroup.GET("/:id", bookHandler.GetBookByID)
-		bookGroup.POST("/", bookHandler.CreateBook)
-		bookGroup.PUT("/:id", bookHandler.UpdateBook)
-		bookGroup.PUT("/restore/:id", bookHandler.Restore)
-		bookGroup.PATCH("/:id", bookHandler.PatchBook)
-		bookGroup.DELETE("/:id", bookHandler.DeleteBook)
+		bookGroup.GET("/code/:code", bookHandler.GetBookByCode)
+		bookGroup.GET("/isbn/:isbn", bookHandler.GetBookByISBN)
+		bookGroup.POST("/", booksWrite, bookHandler.CreateBook)
+		bookGroup.PUT("/:id", booksWrite, bookHandler.UpdateBook)
+		bookGroup.PUT("/restore/:id", booksWrite, bookHandler.Restore)
+		bookGroup.PATCH("/:id", booksWrite, bookHandler.PatchBook)
+		bookGroup.DELETE("/:id", booksWrite, bookHandler.DeleteBook)
+		bookGroup.GET("/:id/images", bookHandler.GetBookImages)
+		bookGroup.POST("/:id/images", booksWrite, bookHandler.AddBookImages)
+		bookGroup.PUT("/:id/images/order", booksWrite, bookHandler.ReorderBookImages)
+		bookGroup.DELETE("/:id/images/:image_id", booksWrite, bookHandler.DeleteBookImage)
+		bookGroup.PUT("/:id/cover", booksWrite, bookHandler.UploadBookCover)
+		bookGroup.DELETE("/:id/cover", booksWrite, bookHandler.DeleteBookCover)
 		bookGroup.GET("/concurrency", bookHandler.GetBooksConcurrently) 
 		bookGroup.GET("/not-concurrency", bookHandler.GetBooksNotConcurrently) 
-		bookGroup.GET("/import", bookHandler.ImportBooks) 
 	}
 }
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"shop-account/handlers"
+	"shop-account/middlewares"
+	"shop-account/models"
+	"github.com/gin-gonic/gin"
+)
+
+func CartRoutes(router *gin.Engine, cartHandler *handlers.CartHandler) {
+	cartGroup := router.Group("/cart")
+	cartGroup.Use(middlewares.RequirePermission(cartHandler.DB, models.PermOrdersPlace))
+	{
+		cartGroup.GET("/", cartHandler.GetCart)
+		cartGroup.DELETE("/", cartHandler.ClearCart)
+		cartGroup.POST("/items", cartHandler.AddItem)
+		cartGroup.PUT("/items/:item_id", cartHandler.UpdateItem)
+		cartGroup.DELETE("/items/:item_id", cartHandler.RemoveItem)
+		cartGroup.POST("/checkout", cartHandler.Checkout)
+	}
+}
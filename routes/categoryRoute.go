@@ -2,17 +2,26 @@ package routes
 
 import (
 	"shop-account/handlers"
+	"shop-account/middlewares"
+	"shop-account/models"
 	"github.com/gin-gonic/gin"
 )
 
 func CategoryRoutes(router *gin.Engine, categoryHandler *handlers.CategoryHandler) {
 	categoryRoutes := router.Group("/categories")
+	categoriesWrite := middlewares.RequirePermission(categoryHandler.DB, models.PermCategoriesWrite)
 	{
-		categoryRoutes.POST("/", categoryHandler.CreateCategory)
+		categoryRoutes.POST("/", categoriesWrite, categoryHandler.CreateCategory)
 		categoryRoutes.GET("/", categoryHandler.GetCategories)
+		// Cây danh mục, breadcrumbs và sách của cả cây con
+		categoryRoutes.GET("/tree", categoryHandler.GetCategoryTree)
+		categoryRoutes.GET("/:id/breadcrumbs", categoryHandler.GetCategoryBreadcrumbs)
+		categoryRoutes.GET("/:id/books", categoryHandler.GetCategoryBooks)
+		categoryRoutes.POST("/:id/move", categoriesWrite, categoryHandler.MoveCategory)
 		categoryRoutes.GET("/:id", categoryHandler.GetCategory)
-		categoryRoutes.PUT("/:id", categoryHandler.UpdateCategory)
-		categoryRoutes.PATCH("/:id", categoryHandler.PatchCategory)
-		categoryRoutes.DELETE("/:id", categoryHandler.DeleteCategory)
+		categoryRoutes.GET("/code/:code", categoryHandler.GetCategoryByCode)
+		categoryRoutes.PUT("/:id", categoriesWrite, categoryHandler.UpdateCategory)
+		categoryRoutes.PATCH("/:id", categoriesWrite, categoryHandler.PatchCategory)
+		categoryRoutes.DELETE("/:id", categoriesWrite, categoryHandler.DeleteCategory)
 	}
 }
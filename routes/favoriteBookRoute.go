@@ -3,12 +3,13 @@ package routes
 import (
     "shop-account/handlers"
     "shop-account/middlewares"
+    "shop-account/models"
     "github.com/gin-gonic/gin"
 )
 
 func FavoriteBookRoutes(router *gin.Engine, favoriteBookHandler *handlers.FavoriteBookHandler) {
     favoriteBookGroup := router.Group("/favorites")
-    favoriteBookGroup.Use(middlewares.AuthMiddleware())
+    favoriteBookGroup.Use(middlewares.RequirePermission(favoriteBookHandler.DB, models.PermFavoritesWrite))
     {
         favoriteBookGroup.POST("/", favoriteBookHandler.CreateFavoriteBook) 
         favoriteBookGroup.GET("/", favoriteBookHandler.GetUserFavoriteBooks) 
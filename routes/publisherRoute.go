@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"shop-account/handlers"
+	"shop-account/middlewares"
+	"shop-account/models"
+	"github.com/gin-gonic/gin"
+)
+
+// PublisherRoutes đăng ký các route cho nhà xuất bản
+func PublisherRoutes(router *gin.Engine, publisherHandler *handlers.PublisherHandler) {
+	publisherGroup := router.Group("/publishers")
+	publisherGroup.Use(middlewares.SetUserIDMiddleware(publisherHandler.DB))
+	publishersWrite := middlewares.RequirePermission(publisherHandler.DB, models.PermPublishersWrite)
+	{
+		publisherGroup.GET("/", publisherHandler.GetPublishers)
+		publisherGroup.GET("/:id", publisherHandler.GetPublisherByID)
+		publisherGroup.GET("/:id/books", publisherHandler.GetPublisherBooks)
+		publisherGroup.GET("/code/:code", publisherHandler.GetPublisherByCode)
+		publisherGroup.POST("/", publishersWrite, publisherHandler.CreatePublisher)
+		publisherGroup.PUT("/:id", publishersWrite, publisherHandler.UpdatePublisher)
+		publisherGroup.PATCH("/:id", publishersWrite, publisherHandler.PatchPublisher)
+		publisherGroup.DELETE("/:id", publishersWrite, publisherHandler.DeletePublisher)
+	}
+}
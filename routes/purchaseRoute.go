@@ -4,11 +4,12 @@ import (
 	"shop-account/handlers"
 	"github.com/gin-gonic/gin"
 	"shop-account/middlewares"
+	"shop-account/models"
 )
 
 func PurchaseRoutes(router *gin.Engine, purchaseHandler *handlers.PurchaseHandler) {
 	purchaseGroup := router.Group("/purchases")
-	purchaseGroup.Use(middlewares.AuthMiddleware())
+	purchaseGroup.Use(middlewares.RequirePermission(purchaseHandler.DB, models.PermOrdersPlace))
 	{
 		purchaseGroup.POST("/:book_id", purchaseHandler.BuyBook) 
 		purchaseGroup.GET("/", purchaseHandler.GetUserPurchases) 
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"shop-account/handlers"
+	"shop-account/middlewares"
+	"shop-account/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewRoutes đăng ký các route cho đánh giá sách
+func ReviewRoutes(router *gin.Engine, reviewHandler *handlers.ReviewHandler) {
+	ordersPlace := middlewares.RequirePermission(reviewHandler.DB, models.PermOrdersPlace)
+
+	router.GET("/books/:id/reviews", reviewHandler.GetBookReviews)
+	router.POST("/books/:id/reviews", ordersPlace, reviewHandler.CreateReview)
+
+	reviewGroup := router.Group("/reviews")
+	reviewGroup.Use(ordersPlace)
+	{
+		reviewGroup.PUT("/:id", reviewHandler.UpdateReview)
+		reviewGroup.DELETE("/:id", reviewHandler.DeleteReview)
+	}
+	router.POST("/reviews/:id/report", middlewares.AuthMiddleware(reviewHandler.DB), reviewHandler.ReportReview)
+}
@@ -7,8 +7,9 @@ import (
 )
 
 // SetupRoutes đăng ký tất cả các route cho API, bao gồm cả xác thực
-func SetupRoutes(router *gin.Engine,favoriteBookHandler *handlers.FavoriteBookHandler, categoryHandler *handlers.CategoryHandler,adminTransactionHandler *admin.AdminTransactionHandler, transactionHandler *handlers.TransactionHandler, purchaseHandler *handlers.PurchaseHandler, userHandler *handlers.UserHandler, authorHandler *handlers.AuthorHandler, bookHandler *handlers.BookHandler, authHandler *handlers.AuthHandler) {
+func SetupRoutes(router *gin.Engine, publisherHandler *handlers.PublisherHandler, reviewHandler *handlers.ReviewHandler, cartHandler *handlers.CartHandler, favoriteBookHandler *handlers.FavoriteBookHandler, categoryHandler *handlers.CategoryHandler,adminTransactionHandler *admin.AdminTransactionHandler, adminInventoryHandler *admin.AdminInventoryHandler, adminRoleHandler *admin.AdminRoleHandler, adminReviewHandler *admin.AdminReviewHandler, adminBookHandler *admin.AdminBookHandler, transactionHandler *handlers.TransactionHandler, purchaseHandler *handlers.PurchaseHandler, userHandler *handlers.UserHandler, authorHandler *handlers.AuthorHandler, bookHandler *handlers.BookHandler, authHandler *handlers.AuthHandler) {
 	AuthorRoutes(router, authorHandler)
+	PublisherRoutes(router, publisherHandler)
 
 	BookRoutes(router, bookHandler)
 	CategoryRoutes(router, categoryHandler)
@@ -16,6 +17,8 @@ func SetupRoutes(router *gin.Engine,favoriteBookHandler *handlers.FavoriteBookHa
 	UserRoutes(router, userHandler)
 	PurchaseRoutes(router, purchaseHandler)
 	TransactionRoutes(router, transactionHandler)
-	AdminRoutes(router, adminTransactionHandler)
+	AdminRoutes(router, adminTransactionHandler, adminInventoryHandler, adminRoleHandler, adminReviewHandler, adminBookHandler)
 	FavoriteBookRoutes(router, favoriteBookHandler)
+	CartRoutes(router, cartHandler)
+	ReviewRoutes(router, reviewHandler)
 }
@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"shop-account/handlers"
+	"shop-account/handlers/admin"
+	"shop-account/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// public routes need no token at all.
+	public = "public"
+	// authenticated routes need a valid token but no particular permission.
+	authenticated = "authenticated"
+)
+
+// routePermissions is the access matrix of the API: the permission each
+// route requires, or public / authenticated. Every registered route must be
+// listed, so a new route cannot ship without a decision about its access.
+var routePermissions = map[string]string{
+	"GET /authors/":           public,
+	"GET /authors/:id":        public,
+	"GET /authors/code/:code": public,
+	"POST /authors/":          models.PermAuthorsWrite,
+	"PUT /authors/:id":        models.PermAuthorsWrite,
+	"PATCH /authors/:id":      models.PermAuthorsWrite,
+	"DELETE /authors/:id":     models.PermAuthorsWrite,
+
+	"GET /publishers/":           public,
+	"GET /publishers/:id":        public,
+	"GET /publishers/:id/books":  public,
+	"GET /publishers/code/:code": public,
+	"POST /publishers/":          models.PermPublishersWrite,
+	"PUT /publishers/:id":        models.PermPublishersWrite,
+	"PATCH /publishers/:id":      models.PermPublishersWrite,
+	"DELETE /publishers/:id":     models.PermPublishersWrite,
+
+	"GET /books/":                        public,
+	"GET /books/search":                  public,
+	"GET /books/:id":                     public,
+	"GET /books/code/:code":              public,
+	"GET /books/isbn/:isbn":              public,
+	"GET /books/:id/images":              public,
+	"GET /books/concurrency":             public,
+	"GET /books/not-concurrency":         public,
+	"POST /books/":                       models.PermBooksWrite,
+	"PUT /books/:id":                     models.PermBooksWrite,
+	"PUT /books/restore/:id":             models.PermBooksWrite,
+	"PATCH /books/:id":                   models.PermBooksWrite,
+	"DELETE /books/:id":                  models.PermBooksWrite,
+	"POST /books/:id/images":             models.PermBooksWrite,
+	"PUT /books/:id/images/order":        models.PermBooksWrite,
+	"DELETE /books/:id/images/:image_id": models.PermBooksWrite,
+	"PUT /books/:id/cover":               models.PermBooksWrite,
+	"DELETE /books/:id/cover":            models.PermBooksWrite,
+
+	"GET /categories/":                public,
+	"GET /categories/tree":            public,
+	"GET /categories/:id":             public,
+	"GET /categories/code/:code":      public,
+	"GET /categories/:id/breadcrumbs": public,
+	"GET /categories/:id/books":       public,
+	"POST /categories/":               models.PermCategoriesWrite,
+	"POST /categories/:id/move":       models.PermCategoriesWrite,
+	"PUT /categories/:id":             models.PermCategoriesWrite,
+	"PATCH /categories/:id":           models.PermCategoriesWrite,
+	"DELETE /categories/:id":          models.PermCategoriesWrite,
+
+	"POST /auth/register":            public,
+	"POST /auth/login":               public,
+	"POST /auth/refresh":             public,
+	"POST /auth/verify-email":        public,
+	"POST /auth/resend-verification": public,
+	"POST /auth/forgot-password":     public,
+	"POST /auth/reset-password":      public,
+	"POST /auth/2fa/verify":          public,
+	"POST /auth/logout":              authenticated,
+	"POST /auth/logout-all":          authenticated,
+	"POST /auth/2fa/enroll":          authenticated,
+	"POST /auth/2fa/confirm":         authenticated,
+	"POST /auth/2fa/disable":         authenticated,
+	"POST /auth/2fa/recovery-codes":  authenticated,
+	"POST /auth/active":              models.PermUsersAdmin,
+	"POST /auth/deactivate":          models.PermUsersAdmin,
+	"PUT /auth/update-role":          models.PermUsersAdmin,
+	"PUT /auth/2fa/require":          models.PermUsersAdmin,
+
+	"GET /users/":           models.PermUsersAdmin,
+	"GET /users/:id":        models.PermUsersAdmin,
+	"GET /users/code/:code": models.PermUsersAdmin,
+	"POST /users/":          models.PermUsersAdmin,
+	"PUT /users/:id":        models.PermUsersAdmin,
+	"DELETE /users/:id":     models.PermUsersAdmin,
+
+	"POST /purchases/:book_id":       models.PermOrdersPlace,
+	"GET /purchases/":                models.PermOrdersPlace,
+	"DELETE /purchases/:purchase_id": models.PermOrdersPlace,
+	"PUT /purchases/:purchase_id":    models.PermOrdersPlace,
+
+	"POST /transactions/":           models.PermOrdersPlace,
+	"GET /transactions/":            models.PermOrdersPlace,
+	"GET /transactions/:id/history": models.PermOrdersPlace,
+	"DELETE /transactions/:id":      models.PermOrdersPlace,
+
+	"GET /admin/transactions":               models.PermOrdersManage,
+	"GET /admin/transactions/code/:code":    models.PermOrdersManage,
+	"PATCH /admin/transactions/:id/status":  models.PermOrdersManage,
+	"GET /admin/inventory/reconcile":        models.PermInventoryManage,
+	"GET /admin/books/:id/stock-movements":  models.PermInventoryManage,
+	"POST /admin/books/:id/stock-movements": models.PermInventoryManage,
+	"GET /admin/roles":                      models.PermUsersAdmin,
+	"POST /admin/roles":                     models.PermUsersAdmin,
+	"PUT /admin/roles/:name/permissions":    models.PermUsersAdmin,
+	"GET /admin/permissions":                models.PermUsersAdmin,
+	"GET /admin/reviews":                    models.PermReviewsModerate,
+	"GET /admin/reviews/:id":                models.PermReviewsModerate,
+	"PATCH /admin/reviews/:id/status":       models.PermReviewsModerate,
+	"POST /admin/books/import":              models.PermBooksWrite,
+	"GET /admin/books/import/:job_id":       models.PermBooksWrite,
+	"GET /admin/books/export":               models.PermBooksWrite,
+
+	"POST /favorites/":      models.PermFavoritesWrite,
+	"GET /favorites/":       models.PermFavoritesWrite,
+	"DELETE /favorites/:id": models.PermFavoritesWrite,
+
+	"GET /cart/":                  models.PermOrdersPlace,
+	"DELETE /cart/":               models.PermOrdersPlace,
+	"POST /cart/items":            models.PermOrdersPlace,
+	"PUT /cart/items/:item_id":    models.PermOrdersPlace,
+	"DELETE /cart/items/:item_id": models.PermOrdersPlace,
+	"POST /cart/checkout":         models.PermOrdersPlace,
+
+	"GET /books/:id/reviews":   public,
+	"POST /books/:id/reviews":  models.PermOrdersPlace,
+	"PUT /reviews/:id":         models.PermOrdersPlace,
+	"DELETE /reviews/:id":      models.PermOrdersPlace,
+	"POST /reviews/:id/report": authenticated,
+}
+
+// publicMutations are the mutating routes that are public on purpose: the
+// sign-up, login and account recovery flows.
+var publicMutations = map[string]bool{
+	"POST /auth/register":            true,
+	"POST /auth/login":               true,
+	"POST /auth/refresh":             true,
+	"POST /auth/verify-email":        true,
+	"POST /auth/resend-verification": true,
+	"POST /auth/forgot-password":     true,
+	"POST /auth/reset-password":      true,
+	"POST /auth/2fa/verify":          true,
+}
+
+// probeAccess is a global middleware that records the access a route
+// requires. For an anonymous request, guarded routes stop in their auth
+// middleware before the handler runs, having recorded their permission;
+// unguarded routes are stopped here, as the handlers have no database.
+func probeAccess(t *testing.T, access *string, fullPath *string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		*fullPath = c.FullPath()
+		*access = public
+		for _, name := range c.HandlerNames() {
+			switch {
+			case strings.Contains(name, "middlewares.RequirePermission"):
+				*access = ""
+			case strings.Contains(name, "middlewares.AuthMiddleware") && *access == public:
+				*access = authenticated
+			}
+		}
+		if *access == public {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+		if permission, ok := c.Get("required_permission"); ok {
+			*access = permission.(string)
+		}
+		if c.Writer.Status() != http.StatusUnauthorized {
+			t.Errorf("%s %s: anonymous request got %d, want 401", c.Request.Method, c.FullPath(), c.Writer.Status())
+		}
+	}
+}
+
+func TestRoutePermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var access, fullPath string
+	router := gin.New()
+	router.Use(probeAccess(t, &access, &fullPath))
+	SetupRoutes(router, &handlers.PublisherHandler{}, &handlers.ReviewHandler{}, &handlers.CartHandler{}, &handlers.FavoriteBookHandler{}, &handlers.CategoryHandler{}, &admin.AdminTransactionHandler{}, &admin.AdminInventoryHandler{}, &admin.AdminRoleHandler{}, &admin.AdminReviewHandler{}, &admin.AdminBookHandler{}, &handlers.TransactionHandler{}, &handlers.PurchaseHandler{}, &handlers.UserHandler{}, &handlers.AuthorHandler{}, &handlers.BookHandler{}, &handlers.AuthHandler{})
+
+	// Parameters are filled with a value that matches no static segment.
+	params := regexp.MustCompile(`:[a-z_]+`)
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+
+		access, fullPath = "", ""
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(route.Method, params.ReplaceAllString(route.Path, "1"), nil))
+		if fullPath != route.Path {
+			t.Errorf("%s: request was routed to %q", key, fullPath)
+			continue
+		}
+
+		if access == public && route.Method != http.MethodGet && !publicMutations[key] {
+			t.Errorf("%s changes data but has no permission check", key)
+		}
+		want, listed := routePermissions[key]
+		if !listed {
+			t.Errorf("%s requires %q but is not in the permission matrix", key, access)
+			continue
+		}
+		if access != want {
+			t.Errorf("%s requires %q, want %q", key, access, want)
+		}
+	}
+	for key := range routePermissions {
+		if !registered[key] {
+			t.Errorf("%s is in the permission matrix but not registered", key)
+		}
+	}
+}
@@ -3,16 +3,18 @@ package routes
 import (
     "shop-account/handlers"
     "shop-account/middlewares"
+    "shop-account/models"
     "github.com/gin-gonic/gin"
 )
 
 func TransactionRoutes(router *gin.Engine, transactionHandler *handlers.TransactionHandler) {
     transactionGroup := router.Group("/transactions")
-    transactionGroup.Use(middlewares.AuthMiddleware())
+    transactionGroup.Use(middlewares.RequirePermission(transactionHandler.DB, models.PermOrdersPlace))
     {
         transactionGroup.POST("/", transactionHandler.CreateTransaction)          
         transactionGroup.GET("/", transactionHandler.GetUserTransactions)        
         // transactionGroup.GET("/:id", purchaseHandler.GetTransactionByID)       
+        transactionGroup.GET("/:id/history", transactionHandler.GetTransactionHistory)
         // transactionGroup.PUT("/:id", purchaseHandler.UpdateTransactionStatus) 
         transactionGroup.DELETE("/:id", transactionHandler.DeleteTransaction)   
     }
@@ -2,16 +2,19 @@ package routes
 
 import (
 	"shop-account/handlers" 
+	"shop-account/middlewares"
+	"shop-account/models"
 	"github.com/gin-gonic/gin"
 )
 
 // UserRoutes registers routes for the User resource
 func UserRoutes(router *gin.Engine, userHandler *handlers.UserHandler) {
 	userGroup := router.Group("/users")
-	// You can add authentication middleware if needed, e.g., userGroup.Use(middlewares.AuthMiddleware())
+	userGroup.Use(middlewares.RequirePermission(userHandler.DB, models.PermUsersAdmin))
 	{
 		userGroup.GET("/", userHandler.List)          
-		userGroup.GET("/:id", userHandler.GetByID)    
+		userGroup.GET("/:id", userHandler.GetByID)
+		userGroup.GET("/code/:code", userHandler.GetByCode)    
 		userGroup.POST("/", userHandler.Create)       
 		userGroup.PUT("/:id", userHandler.Update)     
 		userGroup.DELETE("/:id", userHandler.Delete)  
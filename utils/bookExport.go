@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// BookExportFormats are the formats ExportBooks can write, with their content
+// types.
+var BookExportFormats = map[string]string{
+	"csv":   "text/csv; charset=utf-8",
+	"jsonl": "application/x-ndjson",
+	"xlsx":  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// BookExportRow is one book of a catalog export. Categories are joined with
+// "|", the separator the import accepts; contributors are listed the same way
+// as "Name (role)".
+type BookExportRow struct {
+	ID              uint      `json:"id"`
+	Code            string    `json:"code"`
+	Title           string    `json:"title"`
+	ISBN            string    `json:"isbn"`
+	Description     string    `json:"description"`
+	Author          string    `json:"author"`
+	AuthorCode      string    `json:"author_code"`
+	Contributors    string    `json:"contributors"`
+	Categories      string    `json:"categories"`
+	Publisher       string    `json:"publisher"`
+	PublishedAt     string    `json:"published_at"`
+	PageCount       int64     `json:"page_count"`
+	Language        string    `json:"language"`
+	Format          string    `json:"format"`
+	Edition         string    `json:"edition"`
+	Price           float64   `json:"price"`
+	QuantityInStock int64     `json:"stock"`
+	QuantitySold    int64     `json:"quantity_sold"`
+	Active          bool      `json:"active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+var bookExportHeader = []string{"id", "code", "title", "isbn", "description", "author", "author_code", "contributors", "categories", "publisher", "published_at", "page_count", "language", "format", "edition", "price", "stock", "quantity_sold", "active", "created_at", "updated_at"}
+
+// cells returns the row's values in the order of bookExportHeader; strings
+// are text cells and everything else is numeric.
+func (r BookExportRow) cells() []interface{} {
+	return []interface{}{
+		r.ID, r.Code, r.Title, r.ISBN, r.Description, r.Author, r.AuthorCode, r.Contributors, r.Categories,
+		r.Publisher, r.PublishedAt, r.PageCount, r.Language, r.Format, r.Edition,
+		r.Price, r.QuantityInStock, r.QuantitySold, strconv.FormatBool(r.Active),
+		r.CreatedAt.UTC().Format(time.RFC3339), r.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// numberText formats a numeric cell without exponents.
+func numberText(cell interface{}) string {
+	if number, ok := cell.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(cell)
+}
+
+const bookExportSelect = `books.id, books.code, books.title, books.isbn, books.description,
+	books.price, books.quantity_in_stock, books.quantity_sold, books.active, books.created_at, books.updated_at,
+	COALESCE(authors.name, '') AS author, COALESCE(authors.code, '') AS author_code,
+	COALESCE(publishers.name, '') AS publisher, COALESCE(TO_CHAR(books.published_at, 'YYYY-MM-DD'), '') AS published_at,
+	books.page_count, COALESCE(books.language, '') AS language, COALESCE(books.format, '') AS format, COALESCE(books.edition, '') AS edition,
+	COALESCE((SELECT string_agg(contributors.name || ' (' || book_contributors.role || ')', '|' ORDER BY book_contributors.position)
+		FROM book_contributors
+		JOIN authors contributors ON contributors.id = book_contributors.author_id AND contributors.deleted_at IS NULL
+		WHERE book_contributors.book_id = books.id), '') AS contributors,
+	COALESCE((SELECT string_agg(categories.name, '|' ORDER BY categories.name)
+		FROM book_categories
+		JOIN categories ON categories.id = book_categories.category_id AND categories.deleted_at IS NULL
+		WHERE book_categories.book_id = books.id), '') AS categories`
+
+// bookExportWriter writes the rows of one export format.
+type bookExportWriter interface {
+	Write(row BookExportRow) error
+	Close() error
+}
+
+// ExportBooks writes the books matched by query (a books query with its
+// filters and order) to w in format. Rows are read through a database cursor
+// and written as they arrive, so the catalog is never held in memory; w is
+// flushed every few hundred rows when it supports it. It returns the number
+// of rows written.
+func ExportBooks(query *gorm.DB, format string, w io.Writer) (int, error) {
+	var out bookExportWriter
+	switch format {
+	case "csv":
+		out = newCSVBookExport(w)
+	case "jsonl":
+		out = &jsonlBookExport{encoder: json.NewEncoder(w)}
+	case "xlsx":
+		out = newXLSXBookExport(w)
+	default:
+		return 0, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	rows, err := query.
+		Select(bookExportSelect).
+		Joins("LEFT JOIN authors ON authors.id = books.author_id").
+		Joins("LEFT JOIN publishers ON publishers.id = books.publisher_id").
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var row BookExportRow
+		if err := query.ScanRows(rows, &row); err != nil {
+			return count, err
+		}
+		if err := out.Write(row); err != nil {
+			return count, err
+		}
+		count++
+		if count%500 == 0 {
+			if flusher, ok := w.(interface{ Flush() }); ok {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, out.Close()
+}
+
+type csvBookExport struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVBookExport(w io.Writer) *csvBookExport {
+	return &csvBookExport{writer: csv.NewWriter(w)}
+}
+
+// csvSafe stops spreadsheet programs from running a cell as a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (e *csvBookExport) Write(row BookExportRow) error {
+	if !e.header {
+		e.header = true
+		if err := e.writer.Write(bookExportHeader); err != nil {
+			return err
+		}
+	}
+	record := make([]string, 0, len(bookExportHeader))
+	for _, cell := range row.cells() {
+		if text, ok := cell.(string); ok {
+			record = append(record, csvSafe(text))
+		} else {
+			record = append(record, numberText(cell))
+		}
+	}
+	return e.writer.Write(record)
+}
+
+func (e *csvBookExport) Close() error {
+	if !e.header {
+		e.header = true
+		if err := e.writer.Write(bookExportHeader); err != nil {
+			return err
+		}
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type jsonlBookExport struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonlBookExport) Write(row BookExportRow) error {
+	return e.encoder.Encode(row)
+}
+
+func (e *jsonlBookExport) Close() error {
+	return nil
+}
+
+// xlsxBookExport streams a single-sheet workbook. The zip entries are
+// written in order and the cells use inline strings, so nothing but the
+// current row is buffered.
+type xlsxBookExport struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	err   error
+}
+
+var xlsxStaticParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Books" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func newXLSXBookExport(w io.Writer) *xlsxBookExport {
+	e := &xlsxBookExport{zip: zip.NewWriter(w)}
+	for _, part := range xlsxStaticParts {
+		if e.err = e.writePart(part.name, part.content); e.err != nil {
+			return e
+		}
+	}
+	if e.sheet, e.err = e.zip.Create("xl/worksheets/sheet1.xml"); e.err != nil {
+		return e
+	}
+	_, e.err = io.WriteString(e.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if e.err == nil {
+		header := make([]interface{}, len(bookExportHeader))
+		for i, name := range bookExportHeader {
+			header[i] = name
+		}
+		e.err = e.writeRow(header)
+	}
+	return e
+}
+
+func (e *xlsxBookExport) writePart(name, content string) error {
+	part, err := e.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(part, content)
+	return err
+}
+
+func (e *xlsxBookExport) writeRow(cells []interface{}) error {
+	var b strings.Builder
+	b.WriteString("<row>")
+	for _, cell := range cells {
+		if text, ok := cell.(string); ok {
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&b, []byte(text))
+			b.WriteString("</t></is></c>")
+		} else {
+			b.WriteString("<c><v>" + numberText(cell) + "</v></c>")
+		}
+	}
+	b.WriteString("</row>")
+	_, err := io.WriteString(e.sheet, b.String())
+	return err
+}
+
+func (e *xlsxBookExport) Write(row BookExportRow) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.err = e.writeRow(row.cells())
+	return e.err
+}
+
+func (e *xlsxBookExport) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if _, err := io.WriteString(e.sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return e.zip.Close()
+}
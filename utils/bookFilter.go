@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Facet dimensions; a facet is counted with every filter applied except its
+// own, so the sidebar still shows the other choices of a selected dimension.
+const (
+	FacetCategory = "category"
+	FacetAuthor   = "author"
+	FacetPrice    = "price"
+)
+
+// BookFilter holds the catalog filters of GetBooks and SearchBooks.
+type BookFilter struct {
+	CategoryIDs   []uint
+	MatchAll      bool
+	// AuthorIDs match books with any of these contributors, in any role.
+	AuthorIDs     []uint
+	MinPrice      *float64
+	MaxPrice      *float64
+	InStock       bool
+	Active        *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Order is the ORDER BY clause of the sort parameter, if any.
+	Order string
+}
+
+// ParseBookFilter reads the catalog filters from the query string:
+//
+//	category_ids=1,2&category_match=any|all  author_id=3,4
+//	min_price=10000&max_price=50000  in_stock=true  active=true|false
+//	created_from=2024-01-01&created_to=2024-12-31
+//	sort=newest|oldest|price_asc|price_desc|best_selling|title|title_desc|rating
+//	     or any sortable field of the book QuerySchema, e.g. -price
+func ParseBookFilter(c *gin.Context) (BookFilter, error) {
+	var filter BookFilter
+	var err error
+
+	if filter.CategoryIDs, err = parseIDList(c.Query("category_ids")); err != nil {
+		return filter, fmt.Errorf("invalid category_ids: %v", err)
+	}
+	switch c.DefaultQuery("category_match", "any") {
+	case "any":
+	case "all":
+		filter.MatchAll = true
+	default:
+		return filter, fmt.Errorf("category_match must be any or all")
+	}
+	if filter.AuthorIDs, err = parseIDList(c.Query("author_id")); err != nil {
+		return filter, fmt.Errorf("invalid author_id: %v", err)
+	}
+
+	if filter.MinPrice, err = parseOptionalFloat(c.Query("min_price")); err != nil {
+		return filter, fmt.Errorf("invalid min_price")
+	}
+	if filter.MaxPrice, err = parseOptionalFloat(c.Query("max_price")); err != nil {
+		return filter, fmt.Errorf("invalid max_price")
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, fmt.Errorf("min_price must not be greater than max_price")
+	}
+
+	if value := c.Query("in_stock"); value != "" {
+		if filter.InStock, err = strconv.ParseBool(value); err != nil {
+			return filter, fmt.Errorf("invalid in_stock")
+		}
+	}
+	if value := c.Query("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid active")
+		}
+		filter.Active = &active
+	}
+
+	if filter.CreatedAfter, err = parseOptionalDate(c.Query("created_from")); err != nil {
+		return filter, fmt.Errorf("invalid created_from, expected YYYY-MM-DD")
+	}
+	if filter.CreatedBefore, err = parseOptionalDate(c.Query("created_to")); err != nil {
+		return filter, fmt.Errorf("invalid created_to, expected YYYY-MM-DD")
+	}
+	if filter.CreatedBefore != nil {
+		// created_to is inclusive: keep the whole day.
+		end := filter.CreatedBefore.AddDate(0, 0, 1)
+		filter.CreatedBefore = &end
+	}
+
+	if filter.Order, err = querySchemas["Book"].OrderClause(c.Query("sort")); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// Apply adds the filters to query, except the one of facet (pass "" to apply
+// them all). Columns are qualified with the books table.
+func (f BookFilter) Apply(query *gorm.DB, facet string) *gorm.DB {
+	if len(f.CategoryIDs) > 0 && facet != FacetCategory {
+		if f.MatchAll {
+			query = query.Where(`books.id IN (SELECT book_id FROM book_categories WHERE category_id IN (?)
+				GROUP BY book_id HAVING COUNT(DISTINCT category_id) = ?)`, f.CategoryIDs, len(f.CategoryIDs))
+		} else {
+			query = query.Where("books.id IN (SELECT book_id FROM book_categories WHERE category_id IN (?))", f.CategoryIDs)
+		}
+	}
+	if len(f.AuthorIDs) > 0 && facet != FacetAuthor {
+		query = query.Where("books.id IN (SELECT book_id FROM book_contributors WHERE author_id IN (?))", f.AuthorIDs)
+	}
+	if facet != FacetPrice {
+		if f.MinPrice != nil {
+			query = query.Where("books.price >= ?", *f.MinPrice)
+		}
+		if f.MaxPrice != nil {
+			query = query.Where("books.price <= ?", *f.MaxPrice)
+		}
+	}
+	if f.InStock {
+		query = query.Where("books.quantity_in_stock > 0")
+	}
+	if f.Active != nil {
+		query = query.Where("books.active = ?", *f.Active)
+	}
+	if f.CreatedAfter != nil {
+		query = query.Where("books.created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		query = query.Where("books.created_at < ?", *f.CreatedBefore)
+	}
+	return query
+}
+
+// FacetCount is the number of matching books for one facet value.
+type FacetCount struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// PriceBucket is the number of matching books in a price range. Max is nil
+// for the last, open-ended bucket.
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+// BookFacets are the counts shown next to the catalog results.
+type BookFacets struct {
+	Categories   []FacetCount  `json:"categories"`
+	Authors      []FacetCount  `json:"authors"`
+	PriceBuckets []PriceBucket `json:"price_buckets"`
+}
+
+// priceBucketBounds reads the bucket boundaries from BOOK_PRICE_BUCKETS, a
+// comma-separated ascending list.
+func priceBucketBounds() []float64 {
+	value := os.Getenv("BOOK_PRICE_BUCKETS")
+	if value == "" {
+		value = "50000,100000,200000,500000"
+	}
+	var bounds []float64
+	for _, part := range strings.Split(value, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err == nil && (len(bounds) == 0 || bound > bounds[len(bounds)-1]) {
+			bounds = append(bounds, bound)
+		}
+	}
+	return bounds
+}
+
+// ComputeBookFacets counts the books matching filter per category, per
+// contributor and per price bucket. scopes restrict the candidate books further, e.g. to
+// those matching a search.
+func ComputeBookFacets(db *gorm.DB, filter BookFilter, scopes ...func(*gorm.DB) *gorm.DB) (BookFacets, error) {
+	facets := BookFacets{Categories: []FacetCount{}, Authors: []FacetCount{}, PriceBuckets: []PriceBucket{}}
+	scoped := func(facet string) *gorm.DB {
+		query := db.Table("books").Where("books.deleted_at IS NULL").Scopes(scopes...)
+		return filter.Apply(query, facet)
+	}
+
+	if err := scoped(FacetCategory).
+		Joins("JOIN book_categories ON book_categories.book_id = books.id").
+		Joins("JOIN categories ON categories.id = book_categories.category_id AND categories.deleted_at IS NULL").
+		Select("categories.id AS id, categories.name AS name, COUNT(DISTINCT books.id) AS count").
+		Group("categories.id, categories.name").
+		Order("count DESC, categories.name").
+		Scan(&facets.Categories).Error; err != nil {
+		return facets, err
+	}
+
+	if err := scoped(FacetAuthor).
+		Joins("JOIN book_contributors ON book_contributors.book_id = books.id").
+		Joins("JOIN authors ON authors.id = book_contributors.author_id AND authors.deleted_at IS NULL").
+		Select("authors.id AS id, authors.name AS name, COUNT(DISTINCT books.id) AS count").
+		Group("authors.id, authors.name").
+		Order("count DESC, authors.name").
+		Scan(&facets.Authors).Error; err != nil {
+		return facets, err
+	}
+
+	bounds := priceBucketBounds()
+	cases := make([]string, 0, len(bounds))
+	for i, bound := range bounds {
+		cases = append(cases, fmt.Sprintf("WHEN books.price < %s THEN %d", strconv.FormatFloat(bound, 'f', -1, 64), i))
+	}
+	bucketExpr := fmt.Sprintf("CASE %s ELSE %d END", strings.Join(cases, " "), len(bounds))
+	if len(bounds) == 0 {
+		bucketExpr = "0"
+	}
+
+	var rows []struct {
+		Bucket int
+		Count  int
+	}
+	if err := scoped(FacetPrice).
+		Select(bucketExpr + " AS bucket, COUNT(books.id) AS count").
+		Group("bucket").
+		Scan(&rows).Error; err != nil {
+		return facets, err
+	}
+	counts := make(map[int]int, len(rows))
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+	for i := 0; i <= len(bounds); i++ {
+		bucket := PriceBucket{Count: counts[i]}
+		if i > 0 {
+			bucket.Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			max := bounds[i]
+			bucket.Max = &max
+		}
+		facets.PriceBuckets = append(facets.PriceBuckets, bucket)
+	}
+	return facets, nil
+}
+
+func parseIDList(value string) ([]uint, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("%q is not an ID", part)
+		}
+		// Repeats are dropped so category_match=all compares against the
+		// number of distinct categories.
+		if seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil, fmt.Errorf("invalid number")
+	}
+	return &number, nil
+}
+
+func parseOptionalDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
@@ -0,0 +1,715 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"shop-account/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// BookImportRow is one book read from an import file. Nil Price and Stock
+// mean the column was empty: new books get 0, existing books keep their
+// value.
+type BookImportRow struct {
+	Line        int      `json:"line"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Price       *float64 `json:"price"`
+	Stock       *int     `json:"stock"`
+	Author      string   `json:"author"`
+	AuthorCode  string   `json:"author_code"`
+	Categories  []string `json:"categories"`
+	ISBN        string   `json:"isbn"`
+	ISBN10      string   `json:"isbn10"`
+	Code        string   `json:"code"`
+}
+
+// ImportRowError is a problem with one row of an import file.
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// BookImportResult is what happened to one valid row.
+type BookImportResult struct {
+	Line   int    `json:"line"`
+	Action string `json:"action"`
+	BookID uint   `json:"book_id,omitempty"`
+	Code   string `json:"code,omitempty"`
+	// The authors and categories the row created; they only count towards
+	// the report once the row is saved.
+	authorsCreated    int
+	categoriesCreated int
+}
+
+// BookImportReport summarises an import. In a dry run nothing is saved, and
+// created/updated say what would have happened.
+type BookImportReport struct {
+	DryRun            bool               `json:"dry_run"`
+	TotalRows         int                `json:"total_rows"`
+	Created           int                `json:"created"`
+	Updated           int                `json:"updated"`
+	Failed            int                `json:"failed"`
+	AuthorsCreated    int                `json:"authors_created"`
+	CategoriesCreated int                `json:"categories_created"`
+	Results           []BookImportResult `json:"results"`
+	Errors            []ImportRowError   `json:"errors"`
+}
+
+// BookImportOptions control RunBookImport. Without Upsert, rows matching an
+// existing book by ISBN or code are reported as errors.
+type BookImportOptions struct {
+	DryRun    bool
+	Upsert    bool
+	BatchSize int
+	Actor     StockMovementRef
+}
+
+// BookImportMaxRows is the largest number of rows accepted in one file, from
+// BOOK_IMPORT_MAX_ROWS (default 50000).
+func BookImportMaxRows() int {
+	if value, err := strconv.Atoi(os.Getenv("BOOK_IMPORT_MAX_ROWS")); err == nil && value > 0 {
+		return value
+	}
+	return 50000
+}
+
+// BookImportMaxBytes is the largest import file accepted, from
+// BOOK_IMPORT_MAX_BYTES (default 20MB).
+func BookImportMaxBytes() int64 {
+	if value, err := strconv.ParseInt(os.Getenv("BOOK_IMPORT_MAX_BYTES"), 10, 64); err == nil && value > 0 {
+		return value
+	}
+	return 20 << 20
+}
+
+// BookImportSyncLimit is the number of rows above which an import runs as a
+// background job, from BOOK_IMPORT_SYNC_LIMIT (default 500).
+func BookImportSyncLimit() int {
+	if value, err := strconv.Atoi(os.Getenv("BOOK_IMPORT_SYNC_LIMIT")); err == nil && value >= 0 {
+		return value
+	}
+	return 500
+}
+
+// importColumns maps the accepted CSV header names to row fields.
+var importColumns = map[string]string{
+	"title":             "title",
+	"description":       "description",
+	"price":             "price",
+	"stock":             "stock",
+	"quantity":          "stock",
+	"quantity_in_stock": "stock",
+	"author":            "author",
+	"author_name":       "author",
+	"author_code":       "author_code",
+	"categories":        "categories",
+	"category":          "categories",
+	"isbn":              "isbn",
+	"code":              "code",
+}
+
+// splitCategories splits a categories cell on "|" or ";".
+func splitCategories(value string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == '|' || r == ';' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ParseBookImport reads a CSV (with a header row) or JSON Lines import file.
+// Rows that fail validation are returned as row errors and left out of the
+// rows; a malformed file is returned as an error.
+func ParseBookImport(r io.Reader, format string) ([]BookImportRow, []ImportRowError, error) {
+	var rows []BookImportRow
+	var rowErrors []ImportRowError
+	var err error
+	switch format {
+	case "csv":
+		rows, rowErrors, err = parseBookImportCSV(r)
+	case "jsonl":
+		rows, rowErrors, err = parseBookImportJSONL(r)
+	default:
+		return nil, nil, fmt.Errorf("unsupported import format %q, use csv or jsonl", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows)+len(rowErrors) > BookImportMaxRows() {
+		return nil, nil, fmt.Errorf("import files are limited to %d rows", BookImportMaxRows())
+	}
+
+	// The same book twice in one file is almost certainly a mistake.
+	valid := rows[:0]
+	seen := map[string]int{}
+	for _, row := range rows {
+		var keys []string
+		for _, key := range []string{"isbn:" + row.ISBN, "code:" + row.Code} {
+			if !strings.HasSuffix(key, ":") {
+				keys = append(keys, key)
+			}
+		}
+		duplicate := false
+		for _, key := range keys {
+			if line, ok := seen[key]; ok {
+				rowErrors = append(rowErrors, ImportRowError{Line: row.Line, Field: strings.Split(key, ":")[0], Message: fmt.Sprintf("same book as line %d", line)})
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		// Only accepted rows claim their keys, so a rejected row cannot make
+		// a later one look like a duplicate.
+		for _, key := range keys {
+			seen[key] = row.Line
+		}
+		valid = append(valid, row)
+	}
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Line < rowErrors[j].Line })
+	return valid, rowErrors, nil
+}
+
+func parseBookImportCSV(r io.Reader) ([]BookImportRow, []ImportRowError, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("import file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV header: %v", err)
+	}
+	columns := make([]string, len(header))
+	hasTitle := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		columns[i] = importColumns[name]
+		hasTitle = hasTitle || columns[i] == "title"
+	}
+	if !hasTitle {
+		return nil, nil, fmt.Errorf("CSV header must have a title column")
+	}
+
+	var rows []BookImportRow
+	var rowErrors []ImportRowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, ImportRowError{Line: parseErr.StartLine, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := BookImportRow{Line: line}
+		var fieldErrors []ImportRowError
+		for i, value := range record {
+			if i >= len(columns) || columns[i] == "" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch columns[i] {
+			case "title":
+				row.Title = value
+			case "description":
+				row.Description = value
+			case "price":
+				if value != "" {
+					price, err := strconv.ParseFloat(value, 64)
+					if err != nil {
+						fieldErrors = append(fieldErrors, ImportRowError{Line: line, Field: "price", Message: "price must be a number"})
+						continue
+					}
+					row.Price = &price
+				}
+			case "stock":
+				if value != "" {
+					stock, err := strconv.Atoi(value)
+					if err != nil {
+						fieldErrors = append(fieldErrors, ImportRowError{Line: line, Field: "stock", Message: "stock must be a whole number"})
+						continue
+					}
+					row.Stock = &stock
+				}
+			case "author":
+				row.Author = value
+			case "author_code":
+				row.AuthorCode = value
+			case "categories":
+				row.Categories = splitCategories(value)
+			case "isbn":
+				row.ISBN = value
+			case "code":
+				row.Code = value
+			}
+		}
+		if len(fieldErrors) > 0 {
+			rowErrors = append(rowErrors, fieldErrors...)
+			continue
+		}
+		if rowError := validateImportRow(&row); rowError != nil {
+			rowErrors = append(rowErrors, *rowError)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+// jsonImportRow is the JSON Lines form of a row; categories may be an array
+// or a "|" separated string.
+type jsonImportRow struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Price       *float64        `json:"price"`
+	Stock       *int            `json:"stock"`
+	Author      string          `json:"author"`
+	AuthorCode  string          `json:"author_code"`
+	Categories  json.RawMessage `json:"categories"`
+	ISBN        string          `json:"isbn"`
+	Code        string          `json:"code"`
+}
+
+func parseBookImportJSONL(r io.Reader) ([]BookImportRow, []ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []BookImportRow
+	var rowErrors []ImportRowError
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var decoded jsonImportRow
+		if err := json.Unmarshal([]byte(text), &decoded); err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Line: line, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+		row := BookImportRow{
+			Line:        line,
+			Title:       strings.TrimSpace(decoded.Title),
+			Description: strings.TrimSpace(decoded.Description),
+			Price:       decoded.Price,
+			Stock:       decoded.Stock,
+			Author:      strings.TrimSpace(decoded.Author),
+			AuthorCode:  strings.TrimSpace(decoded.AuthorCode),
+			ISBN:        decoded.ISBN,
+			Code:        strings.TrimSpace(decoded.Code),
+		}
+		if len(decoded.Categories) > 0 && string(decoded.Categories) != "null" {
+			var names []string
+			var joined string
+			if err := json.Unmarshal(decoded.Categories, &names); err == nil {
+				for _, name := range names {
+					row.Categories = append(row.Categories, splitCategories(name)...)
+				}
+			} else if err := json.Unmarshal(decoded.Categories, &joined); err == nil {
+				row.Categories = splitCategories(joined)
+			} else {
+				rowErrors = append(rowErrors, ImportRowError{Line: line, Field: "categories", Message: "categories must be an array or a string"})
+				continue
+			}
+		}
+		if rowError := validateImportRow(&row); rowError != nil {
+			rowErrors = append(rowErrors, *rowError)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read import file: %v", err)
+	}
+	return rows, rowErrors, nil
+}
+
+// validateImportRow checks the values of a row that do not need the
+// database, normalising the ISBN.
+func validateImportRow(row *BookImportRow) *ImportRowError {
+	switch {
+	case row.Title == "" && row.ISBN == "" && row.Code == "":
+		return &ImportRowError{Line: row.Line, Field: "title", Message: "title is required"}
+	case len(row.Title) > 255:
+		return &ImportRowError{Line: row.Line, Field: "title", Message: "title is longer than 255 characters"}
+	case row.Price != nil && *row.Price < 0:
+		return &ImportRowError{Line: row.Line, Field: "price", Message: "price cannot be negative"}
+	case row.Stock != nil && *row.Stock < 0:
+		return &ImportRowError{Line: row.Line, Field: "stock", Message: "stock cannot be negative"}
+	}
+	if row.ISBN != "" {
+		isbn13, isbn10, err := ParseISBN(row.ISBN)
+		if err != nil {
+			return &ImportRowError{Line: row.Line, Field: "isbn", Message: err.Error()}
+		}
+		row.ISBN, row.ISBN10 = isbn13, isbn10
+	}
+	return nil
+}
+
+var errImportDryRun = errors.New("dry run")
+
+// RunBookImport saves the rows in batches of options.BatchSize, each in its
+// own transaction; a row that fails is rolled back to a savepoint and
+// reported without affecting the rest of its batch. A dry run runs the same
+// checks in one transaction that is rolled back. progress, if not nil, is
+// called after every batch with the number of rows processed so far.
+func RunBookImport(db *gorm.DB, rows []BookImportRow, options BookImportOptions, progress func(processed int)) (BookImportReport, error) {
+	report := BookImportReport{DryRun: options.DryRun, TotalRows: len(rows), Results: []BookImportResult{}, Errors: []ImportRowError{}}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+
+	runBatch := func(tx *gorm.DB, batch []BookImportRow) error {
+		for _, row := range batch {
+			if err := tx.Exec("SAVEPOINT import_row").Error; err != nil {
+				return err
+			}
+			result, err := importBookRow(tx, row, options)
+			if err != nil {
+				if err := tx.Exec("ROLLBACK TO SAVEPOINT import_row").Error; err != nil {
+					return err
+				}
+				rowError, ok := err.(*ImportRowError)
+				if !ok {
+					rowError = &ImportRowError{Line: row.Line, Message: err.Error()}
+				}
+				report.Failed++
+				report.Errors = append(report.Errors, *rowError)
+				continue
+			}
+			if err := tx.Exec("RELEASE SAVEPOINT import_row").Error; err != nil {
+				return err
+			}
+			if result.Action == "created" {
+				report.Created++
+			} else {
+				report.Updated++
+			}
+			report.AuthorsCreated += result.authorsCreated
+			report.CategoriesCreated += result.categoriesCreated
+			report.Results = append(report.Results, result)
+		}
+		return nil
+	}
+
+	batches := func(each func(batch []BookImportRow, processed int) error) error {
+		for start := 0; start < len(rows); start += options.BatchSize {
+			end := start + options.BatchSize
+			if end > len(rows) {
+				end = len(rows)
+			}
+			if err := each(rows[start:end], end); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if options.DryRun {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := batches(func(batch []BookImportRow, processed int) error {
+				if err := runBatch(tx, batch); err != nil {
+					return err
+				}
+				if progress != nil {
+					progress(processed)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			return errImportDryRun
+		})
+		if err != errImportDryRun {
+			return report, err
+		}
+		return report, nil
+	}
+
+	err := batches(func(batch []BookImportRow, processed int) error {
+		// Counters are only kept once the batch is committed.
+		saved := report
+		saved.Results = append([]BookImportResult(nil), report.Results...)
+		saved.Errors = append([]ImportRowError(nil), report.Errors...)
+		if err := db.Transaction(func(tx *gorm.DB) error { return runBatch(tx, batch) }); err != nil {
+			report = saved
+			return err
+		}
+		if progress != nil {
+			progress(processed)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// importBookRow creates or updates the book of one row.
+func importBookRow(tx *gorm.DB, row BookImportRow, options BookImportOptions) (BookImportResult, error) {
+	result := BookImportResult{Line: row.Line}
+
+	var book models.Book
+	found := false
+	if row.ISBN != "" {
+		err := tx.Where("isbn = ?", row.ISBN).First(&book).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return result, err
+		}
+		found = err == nil
+	}
+	if row.Code != "" {
+		var byCode models.Book
+		err := tx.Where("code = ?", row.Code).First(&byCode).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return result, &ImportRowError{Line: row.Line, Field: "code", Message: fmt.Sprintf("no book has code %s", row.Code)}
+		}
+		if err != nil {
+			return result, err
+		}
+		if found && byCode.ID != book.ID {
+			return result, &ImportRowError{Line: row.Line, Field: "code", Message: "isbn and code belong to different books"}
+		}
+		book, found = byCode, true
+	}
+	if found && !options.Upsert {
+		return result, &ImportRowError{Line: row.Line, Message: fmt.Sprintf("book %s already exists", book.Code)}
+	}
+	if !found && row.Title == "" {
+		return result, &ImportRowError{Line: row.Line, Field: "title", Message: "title is required for new books"}
+	}
+
+	var author *models.Author
+	if row.Author != "" || row.AuthorCode != "" {
+		resolved, created, err := resolveImportAuthor(tx, row, options.DryRun)
+		if err != nil {
+			return result, err
+		}
+		author = &resolved
+		if created {
+			result.authorsCreated++
+		}
+	} else if !found {
+		return result, &ImportRowError{Line: row.Line, Field: "author", Message: "author or author_code is required for new books"}
+	}
+
+	var categories []models.Category
+	for _, name := range row.Categories {
+		category, created, err := resolveImportCategory(tx, name, options.DryRun, row.Line)
+		if err != nil {
+			return result, err
+		}
+		categories = append(categories, category)
+		if created {
+			result.categoriesCreated++
+		}
+	}
+
+	ref := options.Actor
+	ref.Reason = "import"
+	if !found {
+		code, err := importCode(tx, &models.Book{}, options.DryRun, row.Line)
+		if err != nil {
+			return result, err
+		}
+		book = models.Book{
+			Title:       row.Title,
+			Description: row.Description,
+			AuthorID:    author.ID,
+			ISBN:        row.ISBN,
+			ISBN10:      row.ISBN10,
+			Code:        code,
+			Active:      true,
+			Categories:  categories,
+		}
+		if row.Price != nil {
+			book.Price = *row.Price
+		}
+		if err := tx.Create(&book).Error; err != nil {
+			return result, err
+		}
+		// quantity_in_stock has a column default, so it is set after the
+		// insert to allow importing books with no stock.
+		stock := 0
+		if row.Stock != nil {
+			stock = *row.Stock
+		}
+		if err := tx.Model(&book).UpdateColumn("quantity_in_stock", stock).Error; err != nil {
+			return result, err
+		}
+		if err := SyncPrimaryAuthor(tx, book.ID, book.AuthorID); err != nil {
+			return result, err
+		}
+		ref.Reference = book.Code
+		if err := RecordOpeningStock(tx, book.ID, ref); err != nil {
+			return result, err
+		}
+		result.Action = "created"
+	} else {
+		updates := map[string]interface{}{}
+		if row.Title != "" {
+			updates["title"] = row.Title
+		}
+		if row.Description != "" {
+			updates["description"] = row.Description
+		}
+		if row.Price != nil {
+			updates["price"] = *row.Price
+		}
+		if row.ISBN != "" {
+			updates["isbn"] = row.ISBN
+			updates["isbn10"] = row.ISBN10
+		}
+		if author != nil {
+			updates["author_id"] = author.ID
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&book).Updates(updates).Error; err != nil {
+				return result, err
+			}
+		}
+		if author != nil {
+			if err := SyncPrimaryAuthor(tx, book.ID, author.ID); err != nil {
+				return result, err
+			}
+		}
+		if len(categories) > 0 {
+			if err := tx.Model(&book).Association("Categories").Replace(categories).Error; err != nil {
+				return result, err
+			}
+		}
+		if row.Stock != nil {
+			ref.Reference = book.Code
+			if err := SetStock(tx, book.ID, uint(*row.Stock), ref); err != nil {
+				return result, err
+			}
+		}
+		result.Action = "updated"
+	}
+
+	result.BookID = book.ID
+	result.Code = book.Code
+	return result, nil
+}
+
+// importCode generates the code of a new record. Dry runs use a placeholder
+// so they do not consume sequence values.
+func importCode(tx *gorm.DB, model interface{}, dryRun bool, line int) (string, error) {
+	if dryRun {
+		return fmt.Sprintf("DRYRUN-%s-%d", modelTypeName(model), line), nil
+	}
+	return GenerateCode(tx, model)
+}
+
+// resolveImportAuthor finds the author of a row by code, or by name
+// (ignoring case), creating it when no author has that name.
+func resolveImportAuthor(tx *gorm.DB, row BookImportRow, dryRun bool) (models.Author, bool, error) {
+	var author models.Author
+	if row.AuthorCode != "" {
+		err := tx.Where("code = ?", row.AuthorCode).First(&author).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return author, false, &ImportRowError{Line: row.Line, Field: "author_code", Message: fmt.Sprintf("no author has code %s", row.AuthorCode)}
+		}
+		return author, false, err
+	}
+
+	err := tx.Where("LOWER(name) = LOWER(?)", row.Author).Order("id ASC").First(&author).Error
+	if err == nil || !gorm.IsRecordNotFoundError(err) {
+		return author, false, err
+	}
+	code, err := importCode(tx, &models.Author{}, dryRun, row.Line)
+	if err != nil {
+		return author, false, err
+	}
+	author = models.Author{Name: row.Author, Code: code, Active: true}
+	return author, true, tx.Create(&author).Error
+}
+
+// resolveImportCategory finds a category by name (ignoring case), creating it
+// when it does not exist.
+func resolveImportCategory(tx *gorm.DB, name string, dryRun bool, line int) (models.Category, bool, error) {
+	var category models.Category
+	err := tx.Where("LOWER(name) = LOWER(?)", name).Order("id ASC").First(&category).Error
+	if err == nil || !gorm.IsRecordNotFoundError(err) {
+		return category, false, err
+	}
+	code, err := importCode(tx, &models.Category{}, dryRun, line)
+	if err != nil {
+		return category, false, err
+	}
+	category = models.Category{Name: name, Code: code}
+	return category, true, tx.Create(&category).Error
+}
+
+// StartBookImportJob runs an import in the background, recording its
+// progress and report on job, which must already be saved.
+func StartBookImportJob(db *gorm.DB, job models.ImportJob, rows []BookImportRow, rowErrors []ImportRowError, options BookImportOptions) {
+	go func() {
+		db.Model(&job).UpdateColumns(map[string]interface{}{"status": models.ImportRunning})
+
+		report, err := RunBookImport(db, rows, options, func(processed int) {
+			db.Model(&job).UpdateColumn("processed_rows", processed)
+		})
+		MergeImportErrors(&report, rowErrors)
+
+		now := time.Now()
+		updates := map[string]interface{}{"status": models.ImportCompleted, "finished_at": &now}
+		if err != nil {
+			updates["status"] = models.ImportFailed
+			updates["error"] = err.Error()
+		}
+		if encoded, encodeErr := json.Marshal(report); encodeErr == nil {
+			updates["report"] = string(encoded)
+		}
+		if err := db.Model(&job).UpdateColumns(updates).Error; err != nil {
+			fmt.Printf("Failed to save import job %d: %v\n", job.ID, err)
+		}
+	}()
+}
+
+// FailInterruptedImportJobs marks the jobs left queued or running by a
+// previous process as failed; their goroutines died with it.
+func FailInterruptedImportJobs(db *gorm.DB) error {
+	now := time.Now()
+	return db.Model(&models.ImportJob{}).
+		Where("status IN (?)", []models.ImportJobStatus{models.ImportQueued, models.ImportRunning}).
+		UpdateColumns(map[string]interface{}{"status": models.ImportFailed, "error": "interrupted by a server restart", "finished_at": &now}).Error
+}
+
+// MergeImportErrors adds the errors found while parsing to a report, keeping
+// the report ordered by line.
+func MergeImportErrors(report *BookImportReport, rowErrors []ImportRowError) {
+	report.TotalRows += len(rowErrors)
+	report.Failed += len(rowErrors)
+	report.Errors = append(rowErrors, report.Errors...)
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"shop-account/models"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrCategoryCycle is returned when a category would be moved under
+	// itself or one of its descendants.
+	ErrCategoryCycle = errors.New("a category cannot be moved under itself or one of its descendants")
+	// ErrNoReassignTarget is returned when the books of a top-level category
+	// are reassigned without naming the category that takes them.
+	ErrNoReassignTarget = errors.New("a top-level category's books need a category to be moved to")
+)
+
+// CategoryNotEmptyError is returned when deleting a category that still has
+// subcategories or books without choosing to reassign them.
+type CategoryNotEmptyError struct {
+	Children int
+	Books    int64
+}
+
+func (e *CategoryNotEmptyError) Error() string {
+	return fmt.Sprintf("category has %d subcategories and %d books", e.Children, e.Books)
+}
+
+// LockCategoryTree serialises changes to the shape of the category tree for
+// the rest of tx, so two concurrent moves cannot build a cycle together.
+func LockCategoryTree(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('categories_tree'))").Error
+}
+
+// subtreePattern is the LIKE pattern matching a category and its
+// descendants. Paths only hold digits and slashes, so nothing needs escaping.
+func subtreePattern(path string) string {
+	return path + "%"
+}
+
+// CategorySubtreeScope restricts a books query to the books in category or
+// in any of its descendants.
+func CategorySubtreeScope(category models.Category) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where(`books.id IN (SELECT book_categories.book_id FROM book_categories
+			JOIN categories ON categories.id = book_categories.category_id AND categories.deleted_at IS NULL
+			WHERE categories.path LIKE ?)`, subtreePattern(category.Path))
+	}
+}
+
+// CategoryBreadcrumbs returns the ancestors of category from the top down,
+// followed by the category itself.
+func CategoryBreadcrumbs(db *gorm.DB, category models.Category) ([]models.Category, error) {
+	var ids []uint
+	for _, part := range strings.Split(strings.Trim(category.Path, "/"), "/") {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("category %d has an invalid path %q", category.ID, category.Path)
+		}
+		ids = append(ids, uint(id))
+	}
+
+	var ancestors []models.Category
+	if err := db.Where("id IN (?)", ids).Order("depth ASC").Find(&ancestors).Error; err != nil {
+		return nil, err
+	}
+	return ancestors, nil
+}
+
+// MoveCategory places category under the category parentID (at the top when
+// nil), updating the paths and depths of its whole subtree.
+func MoveCategory(tx *gorm.DB, category *models.Category, parentID *uint) error {
+	if err := LockCategoryTree(tx); err != nil {
+		return err
+	}
+	// Re-read under the lock; the path may have changed since it was loaded.
+	if err := tx.First(category, category.ID).Error; err != nil {
+		return err
+	}
+
+	parent := models.Category{Path: "/", Depth: -1}
+	if parentID != nil {
+		if *parentID == category.ID {
+			return ErrCategoryCycle
+		}
+		if err := tx.First(&parent, *parentID).Error; err != nil {
+			return err
+		}
+		if strings.HasPrefix(parent.Path, category.Path) {
+			return ErrCategoryCycle
+		}
+	}
+
+	oldPath, newPath := category.Path, parent.ChildPath(category.ID)
+	depthDelta := parent.Depth + 1 - category.Depth
+	if err := tx.Model(category).UpdateColumn("parent_id", parentID).Error; err != nil {
+		return err
+	}
+	category.ParentID = parentID
+	if oldPath == newPath {
+		return nil
+	}
+
+	// Soft-deleted descendants are moved too, so a restore finds them in place.
+	if err := tx.Exec(`UPDATE categories SET path = ? || SUBSTR(path, ?), depth = depth + ?
+		WHERE path LIKE ?`, newPath, len(oldPath)+1, depthDelta, subtreePattern(oldPath)).Error; err != nil {
+		return err
+	}
+	category.Path, category.Depth = newPath, parent.Depth+1
+	return nil
+}
+
+// CategoryDeletePlan says what happens to the subcategories and books of a
+// deleted category. Without Reassign, deleting a category that has either is
+// refused. With it, subcategories move up to the deleted category's parent
+// and its books are moved to BooksTo (the parent when nil).
+type CategoryDeletePlan struct {
+	Reassign bool
+	BooksTo  *uint
+}
+
+// CategoryDeleteResult reports what DeleteCategory did.
+type CategoryDeleteResult struct {
+	ChildrenMoved int   `json:"children_moved"`
+	BooksMoved    int64 `json:"books_moved"`
+	BooksTo       *uint `json:"books_moved_to,omitempty"`
+}
+
+// DeleteCategory soft deletes category following plan. It returns a
+// *CategoryNotEmptyError when the category still has subcategories or books
+// and plan does not reassign them.
+func DeleteCategory(tx *gorm.DB, category *models.Category, plan CategoryDeletePlan) (CategoryDeleteResult, error) {
+	var result CategoryDeleteResult
+	if err := LockCategoryTree(tx); err != nil {
+		return result, err
+	}
+	if err := tx.First(category, category.ID).Error; err != nil {
+		return result, err
+	}
+
+	var children []models.Category
+	if err := tx.Where("parent_id = ?", category.ID).Find(&children).Error; err != nil {
+		return result, err
+	}
+	var books int64
+	if err := tx.Table("book_categories").
+		Joins("JOIN books ON books.id = book_categories.book_id AND books.deleted_at IS NULL").
+		Where("book_categories.category_id = ?", category.ID).Count(&books).Error; err != nil {
+		return result, err
+	}
+	if !plan.Reassign && (len(children) > 0 || books > 0) {
+		return result, &CategoryNotEmptyError{Children: len(children), Books: books}
+	}
+
+	for i := range children {
+		if err := MoveCategory(tx, &children[i], category.ParentID); err != nil {
+			return result, err
+		}
+	}
+	result.ChildrenMoved = len(children)
+
+	target := plan.BooksTo
+	if target == nil {
+		target = category.ParentID
+	}
+	if books > 0 {
+		if target == nil {
+			return result, ErrNoReassignTarget
+		}
+		var destination models.Category
+		if err := tx.First(&destination, *target).Error; err != nil {
+			return result, err
+		}
+		if err := tx.Exec(`INSERT INTO book_categories (book_id, category_id)
+			SELECT book_id, ? FROM book_categories WHERE category_id = ?
+			AND book_id NOT IN (SELECT book_id FROM book_categories WHERE category_id = ?)`,
+			destination.ID, category.ID, destination.ID).Error; err != nil {
+			return result, err
+		}
+		result.BooksMoved, result.BooksTo = books, &destination.ID
+	}
+
+	// Soft-deleted books keep no link to a deleted category either.
+	if err := tx.Where("category_id = ?", category.ID).Delete(&models.BookCategory{}).Error; err != nil {
+		return result, err
+	}
+	return result, tx.Delete(category).Error
+}
+
+// SetupCategoryTree rebuilds the path and depth of every category from
+// parent_id, which is the source of truth, and indexes path for subtree
+// queries. It is safe to run at every startup.
+func SetupCategoryTree(db *gorm.DB) error {
+	statements := []string{
+		`WITH RECURSIVE tree AS (
+			SELECT id, '/' || id || '/' AS path, 0 AS depth FROM categories WHERE parent_id IS NULL
+			UNION ALL
+			SELECT categories.id, tree.path || categories.id || '/', tree.depth + 1
+			FROM categories JOIN tree ON categories.parent_id = tree.id
+		)
+		UPDATE categories SET path = tree.path, depth = tree.depth
+		FROM tree WHERE categories.id = tree.id
+			AND (categories.path IS DISTINCT FROM tree.path OR categories.depth IS DISTINCT FROM tree.depth)`,
+		`CREATE INDEX IF NOT EXISTS idx_categories_path ON categories (path text_pattern_ops)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,9 @@
 package utils
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"io"
 	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 )
 
 // ConfigureCloudinary configures the Cloudinary instance using environment variables
@@ -29,27 +26,3 @@ func ConfigureCloudinary() (*cloudinary.Cloudinary, error) {
 
 	return cld, nil
 }
-
-// UploadImageToCloudinary uploads the image to Cloudinary and returns the secure URL
-func UploadImageToCloudinary(file io.Reader) (string, error) {
-	// Configure Cloudinary with environment variables
-	cld, err := ConfigureCloudinary()
-	if err != nil {
-		return "", err
-	}
-
-	// Upload image to Cloudinary
-	uploadResult, err := cld.Upload.Upload(
-		context.Background(), // Background context for the request
-		file,                 // File input (must implement io.Reader)
-		uploader.UploadParams{
-			Folder: "categories", // You can set a folder for the image
-		},
-	)
-	if err != nil {
-		return "", fmt.Errorf("failed to upload image to Cloudinary: %v", err)
-	}
-
-	// Return the secure URL of the uploaded image
-	return uploadResult.SecureURL, nil
-}
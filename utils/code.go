@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"shop-account/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Code formats are templates made of literal text and these segments:
+//
+//	{seq:N}     the next value of the entity's sequence, zero padded to N digits
+//	{date:FMT}  the current date in Go layout FMT, e.g. {date:060102}
+//	{check}     a Luhn check digit over every digit that precedes it
+//
+// A format can be overridden with CODE_FORMAT_<MODEL>, e.g.
+// CODE_FORMAT_BOOK=BK-{seq:6}.
+var defaultCodeFormats = map[string]string{
+	"Category":    "CA{seq:4}",
+	"Book":        "BO{seq:4}",
+	"Author":      "AU{seq:4}",
+	"Publisher":   "PU{seq:4}",
+	"User":        "US{seq:5}",
+	"Transaction": "TST{date:060102}{seq:5}{check}",
+	"Purchase":    "PC{date:060102}{seq:6}",
+}
+
+// codeModels lists every model with a Code column. Each gets its own database
+// sequence and a unique index on code.
+var codeModels = []interface{}{
+	&models.Category{},
+	&models.Book{},
+	&models.Author{},
+	&models.Publisher{},
+	&models.User{},
+	&models.Transaction{},
+	&models.Purchase{},
+}
+
+var codeSegment = regexp.MustCompile(`\{(seq|date|check)(?::([^}]*))?\}`)
+
+func modelTypeName(model interface{}) string {
+	return reflect.TypeOf(model).Elem().Name()
+}
+
+func codeFormat(modelType string) (string, error) {
+	if format := os.Getenv("CODE_FORMAT_" + strings.ToUpper(modelType)); format != "" {
+		return format, nil
+	}
+	format, exists := defaultCodeFormats[modelType]
+	if !exists {
+		return "", fmt.Errorf("unknown model type: %s", modelType)
+	}
+	return format, nil
+}
+
+func codeSequenceName(db *gorm.DB, model interface{}) string {
+	return "code_seq_" + db.NewScope(model).TableName()
+}
+
+// GenerateCode returns a new unique code for model. The number comes from a
+// database sequence, so concurrent calls never get the same value, even in
+// different transactions.
+func GenerateCode(db *gorm.DB, model interface{}) (string, error) {
+	modelType := modelTypeName(model)
+	format, err := codeFormat(modelType)
+	if err != nil {
+		return "", err
+	}
+
+	var next struct{ Value int64 }
+	if err := db.Raw("SELECT nextval(?) AS value", codeSequenceName(db, model)).Scan(&next).Error; err != nil {
+		return "", fmt.Errorf("failed to get next code for model %s: %v", modelType, err)
+	}
+
+	return FormatCode(format, next.Value, time.Now())
+}
+
+// FormatCode renders a code template for sequence value seq.
+func FormatCode(format string, seq int64, now time.Time) (string, error) {
+	var builder strings.Builder
+	last := 0
+	for _, match := range codeSegment.FindAllStringSubmatchIndex(format, -1) {
+		builder.WriteString(format[last:match[0]])
+		last = match[1]
+
+		name := format[match[2]:match[3]]
+		arg := ""
+		if match[4] >= 0 {
+			arg = format[match[4]:match[5]]
+		}
+
+		switch name {
+		case "seq":
+			width := 0
+			if arg != "" {
+				var err error
+				if width, err = strconv.Atoi(arg); err != nil || width < 0 {
+					return "", fmt.Errorf("invalid sequence width %q in code format %q", arg, format)
+				}
+			}
+			builder.WriteString(fmt.Sprintf("%0*d", width, seq))
+		case "date":
+			if arg == "" {
+				arg = "20060102"
+			}
+			builder.WriteString(now.Format(arg))
+		case "check":
+			builder.WriteString(strconv.Itoa(luhnCheckDigit(builder.String())))
+		}
+	}
+	builder.WriteString(format[last:])
+	return builder.String(), nil
+}
+
+// luhnCheckDigit computes the Luhn digit for the digits in s; other
+// characters are ignored.
+func luhnCheckDigit(s string) int {
+	sum := 0
+	double := true
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+// SetupCodes prepares code generation at startup. It creates the sequences,
+// moves them past the numbers the old count-based generator could have used,
+// gives a fresh code to rows with an empty or duplicated one and then adds a
+// unique index on every code column.
+func SetupCodes(db *gorm.DB) error {
+	for _, model := range codeModels {
+		table := db.NewScope(model).TableName()
+		sequence := codeSequenceName(db, model)
+
+		if err := db.Exec(fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s", sequence)).Error; err != nil {
+			return err
+		}
+		if err := db.Exec(fmt.Sprintf(
+			"SELECT setval('%s', GREATEST((SELECT COUNT(*) FROM %s), (SELECT last_value FROM %s), 1))",
+			sequence, table, sequence)).Error; err != nil {
+			return err
+		}
+
+		var ids []uint
+		if err := db.Unscoped().Model(model).
+			Where(fmt.Sprintf("code IS NULL OR code = '' OR id <> (SELECT MIN(other.id) FROM %s other WHERE other.code = %s.code)", table, table)).
+			Order("id").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			code, err := GenerateCode(db, model)
+			if err != nil {
+				return err
+			}
+			if err := db.Unscoped().Model(model).Where("id = ?", id).UpdateColumn("code", code).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := db.Model(model).AddUniqueIndex(fmt.Sprintf("idx_%s_code", table), "code").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"fmt"
+	"shop-account/models"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ContributorInput is one contributor of a book as sent by clients. Role
+// defaults to author and Position to the contributor's index in the list.
+type ContributorInput struct {
+	AuthorID uint   `json:"author_id"`
+	Role     string `json:"role"`
+	Position *int   `json:"position"`
+}
+
+// ContributorError is a contributor list rejected by ResolveContributors.
+type ContributorError struct {
+	Message string
+}
+
+func (e *ContributorError) Error() string {
+	return e.Message
+}
+
+// ResolveContributors validates a contributor list and returns it in display
+// order. Every author must exist, an author can have each role once and at
+// least one contributor must have the author role. An empty list returns
+// nil, meaning the client did not send contributors.
+func ResolveContributors(db *gorm.DB, inputs []ContributorInput) ([]models.BookContributor, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	type ordered struct {
+		contributor models.BookContributor
+		index       int
+	}
+	entries := make([]ordered, 0, len(inputs))
+	seen := map[string]bool{}
+	authorIDs := make([]uint, 0, len(inputs))
+	hasAuthor := false
+	for i, input := range inputs {
+		role := models.ContributorRole(input.Role)
+		if role == "" {
+			role = models.RoleAuthor
+		}
+		if !role.IsValid() {
+			return nil, &ContributorError{Message: fmt.Sprintf("invalid contributor role %q, use author, translator, illustrator or editor", input.Role)}
+		}
+		if input.AuthorID == 0 {
+			return nil, &ContributorError{Message: "every contributor needs an author_id"}
+		}
+		key := fmt.Sprintf("%d/%s", input.AuthorID, role)
+		if seen[key] {
+			return nil, &ContributorError{Message: fmt.Sprintf("author %d is listed twice as %s", input.AuthorID, role)}
+		}
+		seen[key] = true
+		hasAuthor = hasAuthor || role == models.RoleAuthor
+
+		position := i
+		if input.Position != nil {
+			position = *input.Position
+		}
+		entries = append(entries, ordered{models.BookContributor{AuthorID: input.AuthorID, Role: role, Position: position}, i})
+		authorIDs = append(authorIDs, input.AuthorID)
+	}
+	if !hasAuthor {
+		return nil, &ContributorError{Message: "at least one contributor must have the author role"}
+	}
+
+	var found []uint
+	if err := db.Model(&models.Author{}).Where("id IN (?)", authorIDs).Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range authorIDs {
+		if !exists[id] {
+			return nil, &ContributorError{Message: fmt.Sprintf("Author %d not found", id)}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].contributor.Position != entries[j].contributor.Position {
+			return entries[i].contributor.Position < entries[j].contributor.Position
+		}
+		return entries[i].index < entries[j].index
+	})
+	contributors := make([]models.BookContributor, len(entries))
+	for i, entry := range entries {
+		contributors[i] = entry.contributor
+		contributors[i].Position = i
+	}
+	return contributors, nil
+}
+
+// PrimaryAuthorID returns the first contributor with the author role, which
+// is stored as the book's AuthorID.
+func PrimaryAuthorID(contributors []models.BookContributor) uint {
+	for _, contributor := range contributors {
+		if contributor.Role == models.RoleAuthor {
+			return contributor.AuthorID
+		}
+	}
+	return 0
+}
+
+// SetBookContributors replaces the contributors of a book with contributors,
+// as returned by ResolveContributors.
+func SetBookContributors(tx *gorm.DB, bookID uint, contributors []models.BookContributor) error {
+	if err := tx.Where("book_id = ?", bookID).Delete(&models.BookContributor{}).Error; err != nil {
+		return err
+	}
+	for i := range contributors {
+		contributor := models.BookContributor{
+			BookID:   bookID,
+			AuthorID: contributors[i].AuthorID,
+			Role:     contributors[i].Role,
+			Position: i,
+		}
+		if err := tx.Create(&contributor).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncPrimaryAuthor makes authorID the primary author of a book, for clients
+// that only send author_id. An existing co-author is moved to the front;
+// otherwise authorID replaces the current primary author, or is added first
+// when the book has none. Other contributors are kept.
+func SyncPrimaryAuthor(tx *gorm.DB, bookID uint, authorID uint) error {
+	if authorID == 0 {
+		return nil
+	}
+
+	var contributors []models.BookContributor
+	if err := tx.Where("book_id = ?", bookID).Order("position ASC, id ASC").Find(&contributors).Error; err != nil {
+		return err
+	}
+
+	primary, existing := -1, -1
+	for i, contributor := range contributors {
+		if contributor.Role != models.RoleAuthor {
+			continue
+		}
+		if primary < 0 {
+			primary = i
+		}
+		if contributor.AuthorID == authorID && existing < 0 {
+			existing = i
+		}
+	}
+	switch {
+	case primary >= 0 && contributors[primary].AuthorID == authorID:
+		return nil
+	case existing >= 0:
+		moved := contributors[existing]
+		contributors = append(contributors[:existing], contributors[existing+1:]...)
+		contributors = append(contributors[:primary], append([]models.BookContributor{moved}, contributors[primary:]...)...)
+	case primary >= 0:
+		if err := tx.Model(&contributors[primary]).UpdateColumn("author_id", authorID).Error; err != nil {
+			return err
+		}
+		return nil
+	default:
+		added := models.BookContributor{BookID: bookID, AuthorID: authorID, Role: models.RoleAuthor, Position: -1}
+		if err := tx.Create(&added).Error; err != nil {
+			return err
+		}
+		contributors = append([]models.BookContributor{added}, contributors...)
+	}
+
+	for i, contributor := range contributors {
+		if contributor.Position != i {
+			if err := tx.Model(&contributor).UpdateColumn("position", i).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadBookContributors returns the contributors of each of bookIDs in display
+// order, with their authors, using one query. Contributors whose author was
+// deleted are left out.
+func LoadBookContributors(db *gorm.DB, bookIDs []uint) (map[uint][]models.BookContributor, error) {
+	byBook := make(map[uint][]models.BookContributor, len(bookIDs))
+	if len(bookIDs) == 0 {
+		return byBook, nil
+	}
+
+	var contributors []models.BookContributor
+	if err := db.Preload("Author").Where("book_id IN (?)", bookIDs).Order("book_id, position ASC, id ASC").Find(&contributors).Error; err != nil {
+		return nil, err
+	}
+	for _, contributor := range contributors {
+		if contributor.Author.ID == 0 {
+			continue
+		}
+		byBook[contributor.BookID] = append(byBook[contributor.BookID], contributor)
+	}
+	return byBook, nil
+}
+
+// SetupBookContributors gives every book that has no contributors yet its
+// author_id as primary author. It is safe to run at every startup.
+func SetupBookContributors(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO book_contributors (book_id, author_id, role, position, created_at, updated_at)
+		SELECT books.id, books.author_id, ?, 0, NOW(), NOW() FROM books
+		WHERE books.author_id <> 0
+			AND NOT EXISTS (SELECT 1 FROM book_contributors WHERE book_contributors.book_id = books.id)`,
+		models.RoleAuthor).Error
+}
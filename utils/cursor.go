@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"shop-account/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// defaultCursorSort is used in cursor mode when no sort is given: newest
+// first, which is what infinite scrolling lists show.
+const defaultCursorSort = "-id"
+
+// CursorPage is the pagination metadata of a cursor-mode list. Cursors are
+// empty when there is no page in that direction. TotalItems is only set when
+// the client asks for it with with_count=true.
+type CursorPage struct {
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	HasMore    bool   `json:"has_more"`
+	Limit      int    `json:"items_per_page"`
+	TotalItems *int64 `json:"total_items,omitempty"`
+}
+
+// cursorPayload is what a cursor encodes: the sort it belongs to, the sort
+// key values of the row it points at and the direction to read in.
+type cursorPayload struct {
+	Sort      string        `json:"s"`
+	Values    []interface{} `json:"v"`
+	Backwards bool          `json:"b,omitempty"`
+}
+
+var (
+	cursorKeyOnce sync.Once
+	cursorKey     []byte
+)
+
+// cursorSigningKey returns the HMAC key for cursors: CURSOR_SECRET, or
+// JWT_SECRET, or a random key (cursors then expire when the process restarts).
+func cursorSigningKey() []byte {
+	cursorKeyOnce.Do(func() {
+		secret := os.Getenv("CURSOR_SECRET")
+		if secret == "" {
+			secret = os.Getenv("JWT_SECRET")
+		}
+		if secret != "" {
+			cursorKey = []byte(secret)
+			return
+		}
+		cursorKey = make([]byte, 32)
+		if _, err := rand.Read(cursorKey); err != nil {
+			panic(err)
+		}
+	})
+	return cursorKey
+}
+
+// CursorRequested reports whether a list request opted into cursor mode, with
+// pagination=cursor or by sending a cursor.
+func CursorRequested(c *gin.Context) bool {
+	return c.Query("pagination") == "cursor" || c.Query("cursor") != ""
+}
+
+func encodeCursor(payload cursorPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, cursorSigningKey())
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeCursor(cursor string) (cursorPayload, error) {
+	var payload cursorPayload
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return payload, &QueryError{Message: "invalid cursor"}
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return payload, &QueryError{Message: "invalid cursor"}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return payload, &QueryError{Message: "invalid cursor"}
+	}
+	mac := hmac.New(sha256.New, cursorSigningKey())
+	mac.Write(data)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return payload, &QueryError{Message: "invalid cursor"}
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, &QueryError{Message: "invalid cursor"}
+	}
+	return payload, nil
+}
+
+// cursorValue turns a decoded JSON value back into a query argument. NULL is
+// only valid for nullable keys and stays nil.
+func cursorValue(key SortKey, value interface{}) (interface{}, error) {
+	if value == nil {
+		if !key.Nullable {
+			return nil, &QueryError{Message: "invalid cursor"}
+		}
+		return nil, nil
+	}
+	switch key.Type {
+	case TimeField:
+		text, ok := value.(string)
+		if !ok {
+			return nil, &QueryError{Message: "invalid cursor"}
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, &QueryError{Message: "invalid cursor"}
+		}
+		return parsed, nil
+	case NumberField:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, &QueryError{Message: "invalid cursor"}
+		}
+		return number, nil
+	}
+	return value, nil
+}
+
+// keysetCondition builds the WHERE clause selecting rows after values in the
+// order of keys (before them when backwards), e.g. for price DESC, id ASC:
+// price < ? OR (price = ? AND id > ?). NULLs of nullable keys sort last (see
+// orderClause), so they follow every value and nothing follows them.
+func keysetCondition(keys []SortKey, values []interface{}, backwards bool) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	for i, key := range keys {
+		var after string
+		var afterArgs []interface{}
+		operator := ">"
+		if key.Desc != backwards {
+			operator = "<"
+		}
+		switch {
+		case values[i] == nil && backwards:
+			after = key.Column + " IS NOT NULL"
+		case values[i] == nil:
+			// No row comes after a NULL in this key.
+			continue
+		case key.Nullable && !backwards:
+			after = "(" + key.Column + " " + operator + " ? OR " + key.Column + " IS NULL)"
+			afterArgs = []interface{}{values[i]}
+		default:
+			after = key.Column + " " + operator + " ?"
+			afterArgs = []interface{}{values[i]}
+		}
+
+		var parts []string
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				parts = append(parts, keys[j].Column+" IS NULL")
+				continue
+			}
+			parts = append(parts, keys[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+		parts = append(parts, after)
+		args = append(args, afterArgs...)
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(alternatives, " OR "), args
+}
+
+// rowCursor encodes a cursor pointing at row.
+func rowCursor(db *gorm.DB, row interface{}, sortParam string, keys []SortKey, backwards bool) (string, error) {
+	scope := db.NewScope(row)
+	values := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		field, ok := scope.FieldByName(key.Name)
+		if !ok {
+			return "", fmt.Errorf("sort field %s not found on %T", key.Name, row)
+		}
+		value := field.Field.Interface()
+		if field.Field.Kind() == reflect.Ptr && field.Field.IsNil() {
+			value = nil
+		} else if t, ok := value.(time.Time); ok {
+			value = t.UTC().Format(time.RFC3339Nano)
+		} else if t, ok := value.(*time.Time); ok && t != nil {
+			value = t.UTC().Format(time.RFC3339Nano)
+		} else if d, ok := value.(*models.Date); ok && d != nil {
+			value = d.UTC().Format(time.RFC3339Nano)
+		}
+		values = append(values, value)
+	}
+	return encodeCursor(cursorPayload{Sort: sortParam, Values: values, Backwards: backwards})
+}
+
+// PaginateWithCursor is the keyset counterpart of PaginateAndSearch. It takes
+// the same filter, search and sort parameters plus:
+//
+//	cursor=<next_cursor or prev_cursor of a previous page>
+//	with_count=true   also count the matching rows (skipped by default)
+//
+// Rows are read with a WHERE on the sort keys instead of OFFSET, so deep pages
+// stay fast and rows do not repeat or go missing when data changes between
+// requests. Cursors are signed and only valid with the sort they came from.
+func PaginateWithCursor(c *gin.Context, db *gorm.DB, model interface{}, result interface{}) (CursorPage, error) {
+	page := CursorPage{}
+
+	limit, err := parsePageLimit(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		return page, err
+	}
+	page.Limit = limit
+
+	schema, ok := SchemaFor(model)
+	if !ok {
+		return page, fmt.Errorf("no query schema for %T", model)
+	}
+
+	sortParam := c.DefaultQuery("sort", defaultCursorSort)
+	keys, err := schema.SortKeys(sortParam)
+	if err != nil {
+		return page, err
+	}
+
+	query, err := applyListQuery(c, schema, db.Model(model))
+	if err != nil {
+		return page, err
+	}
+
+	if c.Query("with_count") == "true" {
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return page, err
+		}
+		page.TotalItems = &total
+	}
+
+	var payload cursorPayload
+	if cursor := c.Query("cursor"); cursor != "" {
+		if payload, err = decodeCursor(cursor); err != nil {
+			return page, err
+		}
+		if payload.Sort != sortParam || len(payload.Values) != len(keys) {
+			return page, &QueryError{Message: "cursor does not match the requested sort"}
+		}
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			if values[i], err = cursorValue(key, payload.Values[i]); err != nil {
+				return page, err
+			}
+		}
+		condition, args := keysetCondition(keys, values, payload.Backwards)
+		query = query.Where(condition, args...)
+	}
+
+	// One extra row tells whether there is another page in this direction.
+	if err := query.Order(orderClause(keys, payload.Backwards), true).Limit(limit + 1).Find(result).Error; err != nil {
+		return page, err
+	}
+
+	rows := reflect.ValueOf(result).Elem()
+	more := rows.Len() > limit
+	if more {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if payload.Backwards {
+		// Rows were read in reverse order; put them back in display order.
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			first, last := rows.Index(i).Interface(), rows.Index(j).Interface()
+			rows.Index(i).Set(reflect.ValueOf(last))
+			rows.Index(j).Set(reflect.ValueOf(first))
+		}
+	}
+	if rows.Len() == 0 {
+		return page, nil
+	}
+
+	// Going forward there is a previous page whenever we started from a
+	// cursor; going backwards, the extra row says whether one is left.
+	hasNext := more
+	hasPrev := c.Query("cursor") != ""
+	if payload.Backwards {
+		hasNext, hasPrev = true, more
+	}
+	page.HasMore = hasNext
+
+	if hasNext {
+		if page.NextCursor, err = rowCursor(db, rows.Index(rows.Len()-1).Addr().Interface(), sortParam, keys, false); err != nil {
+			return page, err
+		}
+	}
+	if hasPrev {
+		if page.PrevCursor, err = rowCursor(db, rows.Index(0).Addr().Interface(), sortParam, keys, true); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
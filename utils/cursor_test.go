@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	published := []SortKey{
+		{Name: "published_at", Column: "published_at", Nullable: true},
+		{Name: "id", Column: "id"},
+	}
+	price := []SortKey{
+		{Name: "price", Column: "price", Desc: true},
+		{Name: "id", Column: "id"},
+	}
+	tests := []struct {
+		name      string
+		keys      []SortKey
+		values    []interface{}
+		backwards bool
+		where     string
+		args      []interface{}
+	}{
+		{
+			name:   "descending key",
+			keys:   price,
+			values: []interface{}{9.5, 3},
+			where:  "(price < ?) OR (price = ? AND id > ?)",
+			args:   []interface{}{9.5, 9.5, 3},
+		},
+		{
+			name:      "descending key backwards",
+			keys:      price,
+			values:    []interface{}{9.5, 3},
+			backwards: true,
+			where:     "(price > ?) OR (price = ? AND id < ?)",
+			args:      []interface{}{9.5, 9.5, 3},
+		},
+		{
+			name:   "value followed by NULLs",
+			keys:   published,
+			values: []interface{}{"2020-01-01", 5},
+			where:  "((published_at > ? OR published_at IS NULL)) OR (published_at = ? AND id > ?)",
+			args:   []interface{}{"2020-01-01", "2020-01-01", 5},
+		},
+		{
+			name:      "value backwards stops before NULLs",
+			keys:      published,
+			values:    []interface{}{"2020-01-01", 5},
+			backwards: true,
+			where:     "(published_at < ?) OR (published_at = ? AND id < ?)",
+			args:      []interface{}{"2020-01-01", "2020-01-01", 5},
+		},
+		{
+			name:   "NULL only followed by NULLs",
+			keys:   published,
+			values: []interface{}{nil, 5},
+			where:  "(published_at IS NULL AND id > ?)",
+			args:   []interface{}{5},
+		},
+		{
+			name:      "NULL backwards reaches every value",
+			keys:      published,
+			values:    []interface{}{nil, 5},
+			backwards: true,
+			where:     "(published_at IS NOT NULL) OR (published_at IS NULL AND id < ?)",
+			args:      []interface{}{5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := keysetCondition(tt.keys, tt.values, tt.backwards)
+			if where != tt.where {
+				t.Errorf("where = %q, want %q", where, tt.where)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
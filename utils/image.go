@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ImageError is an unacceptable upload; handlers answer it with 400.
+type ImageError struct {
+	Message string
+}
+
+func (e *ImageError) Error() string {
+	return e.Message
+}
+
+// imageExtensions are the accepted image types, by sniffed content type.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImageLimits bound what may be uploaded. They are read from IMAGE_MAX_BYTES
+// (default 5 MB), IMAGE_MIN_DIMENSION (default 100 px) and
+// IMAGE_MAX_DIMENSION (default 6000 px).
+type ImageLimits struct {
+	MaxBytes     int64
+	MinDimension int
+	MaxDimension int
+}
+
+// LoadImageLimits reads the upload limits from the environment.
+func LoadImageLimits() ImageLimits {
+	limits := ImageLimits{MaxBytes: 5 << 20, MinDimension: 100, MaxDimension: 6000}
+	if value, err := strconv.ParseInt(os.Getenv("IMAGE_MAX_BYTES"), 10, 64); err == nil && value > 0 {
+		limits.MaxBytes = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_MIN_DIMENSION")); err == nil && value >= 0 {
+		limits.MinDimension = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_MAX_DIMENSION")); err == nil && value > 0 {
+		limits.MaxDimension = value
+	}
+	return limits
+}
+
+// UploadedImage is a validated image read from a multipart upload.
+type UploadedImage struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// ReadUploadedImage reads and validates an uploaded image. The type is
+// sniffed from the content rather than trusted from the client, and the
+// dimensions are read from the image header.
+func ReadUploadedImage(file *multipart.FileHeader) (UploadedImage, error) {
+	limits := LoadImageLimits()
+	var upload UploadedImage
+
+	if file.Size > limits.MaxBytes {
+		return upload, &ImageError{Message: fmt.Sprintf("image is larger than %d bytes", limits.MaxBytes)}
+	}
+	content, err := file.Open()
+	if err != nil {
+		return upload, err
+	}
+	defer content.Close()
+
+	data, err := readAll(content, limits.MaxBytes)
+	if err != nil {
+		return upload, err
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return upload, &ImageError{Message: fmt.Sprintf("unsupported image type %s, use JPEG, PNG, GIF or WebP", contentType)}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return upload, &ImageError{Message: "image could not be decoded"}
+	}
+	if config.Width < limits.MinDimension || config.Height < limits.MinDimension {
+		return upload, &ImageError{Message: fmt.Sprintf("image must be at least %dx%d pixels", limits.MinDimension, limits.MinDimension)}
+	}
+	if config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return upload, &ImageError{Message: fmt.Sprintf("image must be at most %dx%d pixels", limits.MaxDimension, limits.MaxDimension)}
+	}
+
+	return UploadedImage{
+		Data:        data,
+		ContentType: contentType,
+		Extension:   extension,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
+
+// StoreImage saves an uploaded image under folder with a random name.
+func StoreImage(ctx context.Context, folder string, upload UploadedImage) (StoredObject, error) {
+	name := make([]byte, 12)
+	if _, err := rand.Read(name); err != nil {
+		return StoredObject{}, err
+	}
+	return Files.Put(ctx, folder+"/"+hex.EncodeToString(name)+upload.Extension, upload.Data, upload.ContentType)
+}
+
+// DeleteStoredObjects removes objects that are no longer referenced. It is
+// called after the database change is committed, so a failure only leaves an
+// orphaned file behind and is logged rather than returned.
+func DeleteStoredObjects(keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := Files.Delete(context.Background(), key); err != nil {
+			fmt.Printf("Failed to delete stored object %s: %v\n", key, err)
+		}
+	}
+}
+
+// ImageErrorStatus is the HTTP status for an error returned by
+// ReadUploadedImage.
+func ImageErrorStatus(err error) int {
+	if _, ok := err.(*ImageError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"shop-account/models"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrISBNTaken is returned when another book already has an ISBN.
+var ErrISBNTaken = errors.New("another book already has this ISBN")
+
+var isbnFormat = regexp.MustCompile(`^(\d{9}[\dX]|\d{13})$`)
+
+// NormalizeISBN removes the hyphens and spaces of an ISBN and upper-cases
+// the X check digit.
+func NormalizeISBN(isbn string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+}
+
+func isbn10CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(digits[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+func isbn13CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ParseISBN validates an ISBN-10 or ISBN-13, with or without hyphens and
+// spaces, and returns its ISBN-13 and, for 978 ISBNs, its ISBN-10.
+func ParseISBN(value string) (isbn13 string, isbn10 string, err error) {
+	isbn := NormalizeISBN(value)
+	if !isbnFormat.MatchString(isbn) {
+		return "", "", fmt.Errorf("isbn must have 10 or 13 digits")
+	}
+
+	if len(isbn) == 10 {
+		if isbn[9] != isbn10CheckDigit(isbn) {
+			return "", "", fmt.Errorf("isbn %s has an invalid check digit", value)
+		}
+		isbn13 = "978" + isbn[:9]
+		return isbn13 + string(isbn13CheckDigit(isbn13)), isbn, nil
+	}
+
+	if isbn[12] != isbn13CheckDigit(isbn) {
+		return "", "", fmt.Errorf("isbn %s has an invalid check digit", value)
+	}
+	if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+		return "", "", fmt.Errorf("isbn-13 must start with 978 or 979")
+	}
+	if strings.HasPrefix(isbn, "978") {
+		isbn10 = isbn[3:12] + string(isbn10CheckDigit(isbn[3:12]))
+	}
+	return isbn, isbn10, nil
+}
+
+// CheckISBNAvailable returns ErrISBNTaken when a book other than bookID has
+// isbn13.
+func CheckISBNAvailable(db *gorm.DB, isbn13 string, bookID uint) error {
+	var count int64
+	if err := db.Model(&models.Book{}).Where("isbn = ? AND id <> ?", isbn13, bookID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrISBNTaken
+	}
+	return nil
+}
+
+// SetupBookISBN brings the ISBNs saved before validation existed to their
+// ISBN-13 form and adds the unique index on books.isbn. ISBNs that are not
+// valid are left as they are and reported.
+func SetupBookISBN(db *gorm.DB) error {
+	var books []models.Book
+	if err := db.Unscoped().Select("id, isbn, isbn10").Where("isbn <> '' AND (LENGTH(isbn) <> 13 OR isbn10 = '' OR isbn10 IS NULL)").Find(&books).Error; err != nil {
+		return err
+	}
+	for _, book := range books {
+		isbn13, isbn10, err := ParseISBN(book.ISBN)
+		if err != nil {
+			fmt.Printf("Book %d has an invalid ISBN %q: %v\n", book.ID, book.ISBN, err)
+			continue
+		}
+		if err := db.Unscoped().Model(&models.Book{}).Where("id = ?", book.ID).
+			UpdateColumns(map[string]interface{}{"isbn": isbn13, "isbn10": isbn10}).Error; err != nil {
+			return err
+		}
+	}
+
+	// Soft-deleted books and books without an ISBN do not count.
+	return db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn_unique ON books (isbn)
+		WHERE isbn <> '' AND deleted_at IS NULL`).Error
+}
@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestParseISBN(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		isbn13 string
+		isbn10 string
+		ok     bool
+	}{
+		{"isbn-10 to isbn-13", "0-306-40615-2", "9780306406157", "0306406152", true},
+		{"isbn-13 with hyphens", "978-0-306-40615-7", "9780306406157", "0306406152", true},
+		{"isbn-10 with X check digit", "0-8044-2957-X", "9780804429573", "080442957X", true},
+		{"lower-case x check digit", "080442957x", "9780804429573", "080442957X", true},
+		{"979 prefix has no isbn-10", "979-10-90636-07-1", "9791090636071", "", true},
+		{"bad isbn-10 checksum", "0-306-40615-3", "", "", false},
+		{"bad isbn-13 checksum", "978-0-306-40615-8", "", "", false},
+		{"X only allowed in isbn-10", "978030640615X", "", "", false},
+		{"isbn-13 with another prefix", "1234567890128", "", "", false},
+		{"wrong length", "12345", "", "", false},
+		{"empty", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isbn13, isbn10, err := ParseISBN(tt.value)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseISBN(%q) error = %v, want ok = %v", tt.value, err, tt.ok)
+			}
+			if isbn13 != tt.isbn13 || isbn10 != tt.isbn10 {
+				t.Errorf("ParseISBN(%q) = %q, %q, want %q, %q", tt.value, isbn13, isbn10, tt.isbn13, tt.isbn10)
+			}
+		})
+	}
+}
@@ -1,42 +1,273 @@
 package utils
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"time"
+
 	"github.com/dgrijalva/jwt-go"
-	// "log"
 )
 
-var SecretKey = []byte("your-secret-key") // Đặt một secret key cho JWT
+// SigningKey is one key the token service can verify with. Keys that only
+// have a VerifyKey (e.g. a retired RSA key of which only the public half is
+// kept) can still validate tokens but are never used to sign.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// TokenService issues and validates every JWT in the application. Tokens
+// carry the ID of the key that signed them in the `kid` header, so older keys
+// can stay active for verification while new tokens are signed with the
+// current one.
+type TokenService struct {
+	keys           map[string]*SigningKey
+	currentKeyID   string
+	AccessTokenTTL time.Duration
+	Issuer         string
+	Audience       string
+}
+
+// Tokens is the token service configured at startup by InitTokenService.
+var Tokens *TokenService
+
+// InitTokenService builds Tokens from the environment.
+func InitTokenService() error {
+	service, err := NewTokenServiceFromEnv()
+	if err != nil {
+		return err
+	}
+	Tokens = service
+	return nil
+}
+
+// NewTokenServiceFromEnv configures a token service from these variables:
+//
+//	JWT_KEYS              comma-separated kid:alg:material entries. For HS256
+//	                      the material is the secret; for RS256 and EdDSA it
+//	                      is the path to a PEM file holding a private key (or
+//	                      only a public key for verify-only keys).
+//	JWT_CURRENT_KEY_ID    kid used to sign new tokens (default: first key).
+//	JWT_SECRET            shorthand for a single HS256 key when JWT_KEYS is
+//	                      not set.
+//	JWT_ACCESS_TOKEN_TTL  access token lifetime as a Go duration (default
+//	                      15m; sessions are kept alive with refresh tokens).
+//	JWT_ISSUER            iss claim to set and require (optional).
+//	JWT_AUDIENCE          aud claim to set and require (optional).
+func NewTokenServiceFromEnv() (*TokenService, error) {
+	service := &TokenService{
+		keys:           map[string]*SigningKey{},
+		AccessTokenTTL: 15 * time.Minute,
+		Issuer:         os.Getenv("JWT_ISSUER"),
+		Audience:       os.Getenv("JWT_AUDIENCE"),
+	}
+
+	if ttl := os.Getenv("JWT_ACCESS_TOKEN_TTL"); ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid JWT_ACCESS_TOKEN_TTL %q", ttl)
+		}
+		service.AccessTokenTTL = duration
+	}
+
+	keySpec := os.Getenv("JWT_KEYS")
+	if keySpec == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("missing JWT_KEYS or JWT_SECRET environment variable")
+		}
+		keySpec = "default:HS256:" + secret
+	}
+
+	for _, entry := range strings.Split(keySpec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid:alg:material", entry)
+		}
+		key, err := loadSigningKey(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, err
+		}
+		if err := service.AddKey(key); err != nil {
+			return nil, err
+		}
+		if service.currentKeyID == "" {
+			service.currentKeyID = key.ID
+		}
+	}
+
+	if current := os.Getenv("JWT_CURRENT_KEY_ID"); current != "" {
+		service.currentKeyID = current
+	}
+	current, ok := service.keys[service.currentKeyID]
+	if !ok {
+		return nil, fmt.Errorf("current JWT key %q is not configured", service.currentKeyID)
+	}
+	if current.SignKey == nil {
+		return nil, fmt.Errorf("current JWT key %q has no private key to sign with", current.ID)
+	}
 
-// Struct cho claims của JWT
-type Claims struct {
-	Username string `json:"username"`
-	jwt.StandardClaims
+	return service, nil
 }
 
-// Hàm tạo JWT token
-func GenerateToken(username string) (string, error) {
-	claims := Claims{
-		Username: username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(), // Token có hiệu lực trong 24 giờ
-		},
+// AddKey registers a key for verification (and signing, if it has a SignKey).
+func (s *TokenService) AddKey(key *SigningKey) error {
+	if key.ID == "" {
+		return errors.New("JWT key ID must not be empty")
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(SecretKey)
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate JWT key ID %q", key.ID)
+	}
+	s.keys[key.ID] = key
+	return nil
 }
 
-// Hàm kiểm tra và parse JWT token
-func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
+func loadSigningKey(kid, alg, material string) (*SigningKey, error) {
+	key := &SigningKey{ID: kid}
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		if len(material) < 16 {
+			return nil, fmt.Errorf("JWT key %q: HMAC secret must be at least 16 characters", kid)
+		}
+		key.Method = jwt.GetSigningMethod(alg)
+		key.SignKey = []byte(material)
+		key.VerifyKey = []byte(material)
+	case "RS256", "RS384", "RS512":
+		data, err := os.ReadFile(material)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %v", kid, err)
+		}
+		key.Method = jwt.GetSigningMethod(alg)
+		if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.SignKey = privateKey
+			key.VerifyKey = &privateKey.PublicKey
+		} else if publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key.VerifyKey = publicKey
+		} else {
+			return nil, fmt.Errorf("JWT key %q: %s is not an RSA PEM key", kid, material)
+		}
+	case "EdDSA":
+		data, err := os.ReadFile(material)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %v", kid, err)
+		}
+		key.Method = SigningMethodEdDSA
+		if err := loadEd25519Key(key, data); err != nil {
+			return nil, fmt.Errorf("JWT key %q: %v", kid, err)
+		}
+	default:
+		return nil, fmt.Errorf("JWT key %q: unsupported algorithm %q", kid, alg)
+	}
+	return key, nil
+}
+
+func loadEd25519Key(key *SigningKey, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("no PEM block found")
+	}
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		privateKey, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return errors.New("private key is not an Ed25519 key")
+		}
+		key.SignKey = privateKey
+		key.VerifyKey = privateKey.Public()
+		return nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errors.New("PEM block is neither a PKCS8 private key nor a PKIX public key")
+	}
+	publicKey, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return errors.New("public key is not an Ed25519 key")
+	}
+	key.VerifyKey = publicKey
+	return nil
+}
+
+// GenerateToken signs claims with the current key, adding the standard exp,
+// iat, iss and aud claims.
+func (s *TokenService) GenerateToken(claims jwt.MapClaims) (string, error) {
+	return s.GenerateTokenWithTTL(claims, s.AccessTokenTTL)
+}
+
+// GenerateTokenWithTTL is GenerateToken with an explicit lifetime.
+func (s *TokenService) GenerateTokenWithTTL(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	key := s.keys[s.currentKeyID]
+
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	if s.Issuer != "" {
+		claims["iss"] = s.Issuer
+	}
+	if s.Audience != "" {
+		claims["aud"] = s.Audience
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey)
+}
+
+// ParseToken verifies a token with the key named by its `kid` header and
+// checks expiry, issuer and audience. Tokens without a `kid` are checked
+// against the current key.
+func (s *TokenService) ParseToken(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = s.currentKeyID
+		}
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// Refuse tokens whose alg header does not match the key, so an RSA
+		// public key can never be used as an HMAC secret.
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.VerifyKey, nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, err
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if s.Issuer != "" && !claims.VerifyIssuer(s.Issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if s.Audience != "" && !claims.VerifyAudience(s.Audience, true) {
+		return nil, errors.New("invalid token audience")
 	}
 	return claims, nil
 }
+
+// ExtractBearerToken returns the token from an "Authorization: Bearer <token>"
+// header value.
+func ExtractBearerToken(authHeader string) (string, error) {
+	if authHeader == "" {
+		return "", errors.New("missing authorization token")
+	}
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", errors.New("invalid authorization format")
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailMessage is a plain-text email.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email. Implementations are chosen with MAIL_DRIVER.
+type Mailer interface {
+	Send(message MailMessage) error
+}
+
+// Mail is the mailer configured at startup by InitMailer.
+var Mail Mailer
+
+// InitMailer builds Mail from the environment:
+//
+//	MAIL_DRIVER    smtp, file or memory (default memory)
+//	MAIL_FROM      sender address
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD  for the smtp driver
+//	MAIL_DIR       output directory for the file driver (default ./mail)
+func InitMailer() error {
+	from := os.Getenv("MAIL_FROM")
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		mailer := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		if mailer.Host == "" || mailer.Port == "" || mailer.From == "" {
+			return fmt.Errorf("missing SMTP_HOST, SMTP_PORT or MAIL_FROM for the smtp mail driver")
+		}
+		Mail = mailer
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		Mail = &FileMailer{Dir: dir, From: from}
+	case "", "memory":
+		Mail = &MemoryMailer{}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+	return nil
+}
+
+// SMTPMailer sends mail through an SMTP server using PLAIN auth.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(message MailMessage) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{message.To}, formatMail(m.From, message))
+}
+
+// FileMailer writes every message as an .eml file, for development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(message MailMessage) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(message.To, "@", "_at_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMail(m.From, message), 0o644)
+}
+
+// MemoryMailer keeps sent messages in memory, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+func (m *MemoryMailer) Send(message MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far.
+func (m *MemoryMailer) Messages() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MailMessage(nil), m.messages...)
+}
+
+func formatMail(from string, message MailMessage) []byte {
+	headers := []string{
+		"From: " + from,
+		"To: " + message.To,
+		"Subject: " + message.Subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + message.Body)
+}
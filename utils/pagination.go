@@ -9,24 +9,48 @@ import (
 	"strconv"
 )
 
-// PaginateAndSearch handles pagination, dynamic search on custom fields, and custom query operators
+// MaxPageLimit is the largest page size list endpoints accept, so a single
+// request cannot read a whole table.
+const MaxPageLimit = 100
+
+// parsePageLimit reads the limit parameter of a list request.
+func parsePageLimit(value string) (int, error) {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 || limit > MaxPageLimit {
+		return 0, &QueryError{Message: fmt.Sprintf("limit must be between 1 and %d", MaxPageLimit)}
+	}
+	return limit, nil
+}
+
+// PaginateAndSearch handles pagination, search and the filter/sort DSL of
+// list endpoints:
+//
+//	page=2&limit=20
+//	filter[price][gte]=100&filter[status][in]=pending,approved
+//	sort=-created_at,title
+//	search=term&search_fields=title,code&search_operator=OR
+//
+// Only the fields whitelisted in the model's QuerySchema can be used; anything
+// else is reported as a *QueryError.
 func PaginateAndSearch(c *gin.Context, db *gorm.DB, model interface{}, result interface{}, customQuery *gorm.DB) (int64, int, int, error) {
 	// Get pagination parameters from query
 	pageStr := c.DefaultQuery("page", "1")  // Default to page 1 if not provided
 	limitStr := c.DefaultQuery("limit", "10") // Default to limit 10 if not provided
-	search := c.DefaultQuery("search", "")  // Default to empty string if no search query provided
-	searchFields := c.DefaultQuery("search_fields", "") // Fields to search by (comma-separated)
-	searchOperator := c.DefaultQuery("search_operator", "OR") // Operator to combine search conditions
 
 	// Parse page and limit to integers
 	page, err := strconv.Atoi(pageStr)
 	if err != nil || page <= 0 {
-		return 0, 0, 0, fmt.Errorf("invalid page number")
+		return 0, 0, 0, &QueryError{Message: "invalid page number"}
 	}
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		return 0, 0, 0, fmt.Errorf("invalid limit")
+	limit, err := parsePageLimit(limitStr)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	schema, ok := SchemaFor(model)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("no query schema for %T", model)
 	}
 
 	// Calculate the offset for pagination
@@ -40,28 +64,19 @@ func PaginateAndSearch(c *gin.Context, db *gorm.DB, model interface{}, result in
 		query = customQuery
 	}
 
-	// Apply dynamic search if search is provided
-	if search != "" && searchFields != "" {
-		// Split search fields into a list
-		fields := strings.Split(searchFields, ",")
-		operator := strings.ToUpper(searchOperator)
-		if operator != "AND" && operator != "OR" {
-			operator = "OR" // Default to OR if an invalid operator is provided
-		}
+	if query, err = applyListQuery(c, schema, query); err != nil {
+		return 0, 0, 0, err
+	}
 
-		// Build the search conditions dynamically
-		var conditions []string
-		var args []interface{}
-		for _, field := range fields {
-			conditions = append(conditions, fmt.Sprintf("LOWER(%s) LIKE ?", field))
-			args = append(args, "%"+strings.ToLower(search)+"%")
+	// A requested sort replaces the handler's default order.
+	if sortParam := c.Query("sort"); sortParam != "" {
+		order, err := schema.OrderClause(sortParam)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if order != "" {
+			query = query.Order(order, true)
 		}
-
-		// Combine the conditions using the specified operator (AND/OR)
-		conditionString := strings.Join(conditions, fmt.Sprintf(" %s ", operator))
-
-		// Apply the dynamic search condition
-		query = query.Where(conditionString, args...)
 	}
 
 	// Get the total number of records (for pagination)
@@ -80,3 +95,82 @@ func PaginateAndSearch(c *gin.Context, db *gorm.DB, model interface{}, result in
 
 	return totalItems, page, totalPages, nil
 }
+
+// applyListQuery adds the filter DSL and the search parameters to query.
+func applyListQuery(c *gin.Context, schema QuerySchema, query *gorm.DB) (*gorm.DB, error) {
+	search := c.DefaultQuery("search", "")  // Default to empty string if no search query provided
+	searchFields := c.DefaultQuery("search_fields", "") // Fields to search by (comma-separated)
+	searchOperator := c.DefaultQuery("search_operator", "OR") // Operator to combine search conditions
+
+	query, err := schema.ApplyFilters(query, c.Request.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply dynamic search if search is provided
+	if search != "" && searchFields != "" {
+		operator := strings.ToUpper(searchOperator)
+		if operator != "AND" && operator != "OR" {
+			operator = "OR" // Default to OR if an invalid operator is provided
+		}
+
+		conditionString, args, err := schema.SearchCondition(search, strings.Split(searchFields, ","), operator)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(conditionString, args...)
+	}
+	return query, nil
+}
+
+// ListQuery applies the filter, search and sort parameters of a list request
+// to query without paginating it, for endpoints that read every matching row.
+// The default sort is by id.
+func ListQuery(c *gin.Context, query *gorm.DB, model interface{}) (*gorm.DB, error) {
+	schema, ok := SchemaFor(model)
+	if !ok {
+		return nil, fmt.Errorf("no query schema for %T", model)
+	}
+	order, err := schema.OrderClause(c.DefaultQuery("sort", "id"))
+	if err != nil {
+		return nil, err
+	}
+	query, err = applyListQuery(c, schema, query.Model(model))
+	if err != nil {
+		return nil, err
+	}
+	return query.Order(order, true), nil
+}
+
+// PaginateList runs a list query in offset mode (PaginateAndSearch) or, when
+// the client asks for it, in cursor mode (PaginateWithCursor). It returns the
+// pagination fields of the response; the caller adds the items.
+func PaginateList(c *gin.Context, query *gorm.DB, model interface{}, result interface{}) (gin.H, error) {
+	if CursorRequested(c) {
+		page, err := PaginateWithCursor(c, query, model, result)
+		if err != nil {
+			return nil, err
+		}
+		meta := gin.H{
+			"next_cursor":    page.NextCursor,
+			"prev_cursor":    page.PrevCursor,
+			"has_more":       page.HasMore,
+			"items_per_page": page.Limit,
+		}
+		if page.TotalItems != nil {
+			meta["total_items"] = *page.TotalItems
+		}
+		return meta, nil
+	}
+
+	totalItems, page, totalPages, err := PaginateAndSearch(c, query, model, result, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"current_page":   page,
+		"total_pages":    totalPages,
+		"total_items":    totalItems,
+		"items_per_page": c.DefaultQuery("limit", "10"),
+	}, nil
+}
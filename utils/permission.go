@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"shop-account/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// RolePermissions returns the names of the permissions granted to a role.
+func RolePermissions(db *gorm.DB, roleName string) ([]string, error) {
+	var names []string
+	err := db.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ? AND roles.deleted_at IS NULL AND permissions.deleted_at IS NULL", roleName).
+		Pluck("permissions.name", &names).Error
+	return names, err
+}
+
+// HasPermission reports whether the authenticated user of the request holds
+// permission. The permissions are put in the context by the auth middleware.
+func HasPermission(c *gin.Context, permission string) bool {
+	permissions, _ := c.Get("permissions")
+	names, _ := permissions.([]string)
+	for _, name := range names {
+		if name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// SeedRolesAndPermissions creates missing permissions and default roles, and
+// grants the default roles any of their default permissions they lack, so
+// permissions added to DefaultRolePermissions reach existing databases. Admin
+// is always granted every permission. Other permissions granted to a role are
+// kept; a default permission removed from a default role is granted again at
+// the next start, so restricted access belongs in a custom role.
+func SeedRolesAndPermissions(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		permissions := map[string]models.Permission{}
+		for name, description := range models.AllPermissions {
+			var permission models.Permission
+			if err := tx.Where(models.Permission{Name: name}).
+				Attrs(models.Permission{Description: description}).
+				FirstOrCreate(&permission).Error; err != nil {
+				return err
+			}
+			permissions[name] = permission
+		}
+
+		for roleName, granted := range models.DefaultRolePermissions {
+			if roleName == "admin" {
+				granted = nil
+				for name := range permissions {
+					granted = append(granted, name)
+				}
+			}
+			defaults := make([]models.Permission, 0, len(granted))
+			for _, name := range granted {
+				defaults = append(defaults, permissions[name])
+			}
+
+			var role models.Role
+			err := tx.Where("name = ?", roleName).First(&role).Error
+			if gorm.IsRecordNotFoundError(err) {
+				role = models.Role{Name: roleName, Permissions: defaults}
+				if err := tx.Create(&role).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if len(defaults) == 0 {
+				continue
+			}
+			// Append skips the permissions the role already has.
+			if err := tx.Model(&role).Association("Permissions").Append(defaults).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
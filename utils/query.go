@@ -0,0 +1,498 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FieldType decides how filter values are parsed and which operators apply.
+type FieldType int
+
+const (
+	StringField FieldType = iota
+	NumberField
+	BoolField
+	TimeField
+)
+
+// QueryField is a column that list endpoints may filter or sort on.
+type QueryField struct {
+	Column   string
+	Type     FieldType
+	Sortable bool
+	// Searchable fields may be used in search_fields.
+	Searchable bool
+	// Nullable columns sort with NULLS LAST, and cursors handle NULL values.
+	Nullable bool
+}
+
+// QuerySchema whitelists the fields of one model for the list DSL.
+type QuerySchema struct {
+	Table  string
+	Fields map[string]QueryField
+	// SortAliases are named sorts, e.g. "newest" for "-created_at".
+	SortAliases map[string]string
+}
+
+// QueryError is a client mistake in the list query string; handlers answer it
+// with 400.
+type QueryError struct {
+	Message string
+	Allowed []string
+}
+
+func (e *QueryError) Error() string {
+	if len(e.Allowed) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (allowed: %s)", e.Message, strings.Join(e.Allowed, ", "))
+}
+
+// ListErrorStatus is the HTTP status for an error returned by
+// PaginateAndSearch.
+func ListErrorStatus(err error) int {
+	if _, ok := err.(*QueryError); ok {
+		return 400
+	}
+	return 500
+}
+
+func baseFields(table string) map[string]QueryField {
+	return map[string]QueryField{
+		"id":         {Column: table + ".id", Type: NumberField, Sortable: true},
+		"created_at": {Column: table + ".created_at", Type: TimeField, Sortable: true},
+		"updated_at": {Column: table + ".updated_at", Type: TimeField, Sortable: true},
+	}
+}
+
+func withFields(fields map[string]QueryField, extra map[string]QueryField) map[string]QueryField {
+	for name, field := range extra {
+		fields[name] = field
+	}
+	return fields
+}
+
+// querySchemas are keyed by model type name.
+var querySchemas = map[string]QuerySchema{
+	"Book": {
+		Table: "books",
+		Fields: withFields(baseFields("books"), map[string]QueryField{
+			"title":             {Column: "books.title", Type: StringField, Sortable: true, Searchable: true},
+			"description":       {Column: "books.description", Type: StringField, Searchable: true},
+			"code":              {Column: "books.code", Type: StringField, Sortable: true, Searchable: true},
+			"isbn":              {Column: "books.isbn", Type: StringField, Searchable: true},
+			"isbn10":            {Column: "books.isbn10", Type: StringField, Searchable: true},
+			"publisher_id":      {Column: "books.publisher_id", Type: NumberField},
+			"published_at":      {Column: "books.published_at", Type: TimeField, Sortable: true, Nullable: true},
+			"page_count":        {Column: "books.page_count", Type: NumberField, Sortable: true},
+			"language":          {Column: "books.language", Type: StringField, Searchable: true},
+			"format":            {Column: "books.format", Type: StringField, Searchable: true},
+			"edition":           {Column: "books.edition", Type: StringField, Searchable: true},
+			"price":             {Column: "books.price", Type: NumberField, Sortable: true},
+			"author_id":         {Column: "books.author_id", Type: NumberField},
+			"active":            {Column: "books.active", Type: BoolField},
+			"quantity_in_stock": {Column: "books.quantity_in_stock", Type: NumberField, Sortable: true},
+			"quantity_sold":     {Column: "books.quantity_sold", Type: NumberField, Sortable: true},
+			"average_rating":    {Column: "books.average_rating", Type: NumberField, Sortable: true},
+			"review_count":      {Column: "books.review_count", Type: NumberField, Sortable: true},
+		}),
+		SortAliases: map[string]string{
+			"newest":       "-created_at",
+			"oldest":       "created_at",
+			"price_asc":    "price",
+			"price_desc":   "-price",
+			"best_selling": "-quantity_sold",
+			"title_desc":   "-title",
+			"rating":       "-average_rating,-review_count",
+		},
+	},
+	"Author": {
+		Table: "authors",
+		Fields: withFields(baseFields("authors"), map[string]QueryField{
+			"name":   {Column: "authors.name", Type: StringField, Sortable: true, Searchable: true},
+			"bio":    {Column: "authors.bio", Type: StringField, Searchable: true},
+			"code":   {Column: "authors.code", Type: StringField, Sortable: true, Searchable: true},
+			"active": {Column: "authors.active", Type: BoolField},
+		}),
+	},
+	"Publisher": {
+		Table: "publishers",
+		Fields: withFields(baseFields("publishers"), map[string]QueryField{
+			"name":    {Column: "publishers.name", Type: StringField, Sortable: true, Searchable: true},
+			"country": {Column: "publishers.country", Type: StringField, Sortable: true, Searchable: true},
+			"code":    {Column: "publishers.code", Type: StringField, Sortable: true, Searchable: true},
+			"active":  {Column: "publishers.active", Type: BoolField},
+		}),
+	},
+	"Category": {
+		Table: "categories",
+		Fields: withFields(baseFields("categories"), map[string]QueryField{
+			"name":        {Column: "categories.name", Type: StringField, Sortable: true, Searchable: true},
+			"description": {Column: "categories.description", Type: StringField, Searchable: true},
+			"code":        {Column: "categories.code", Type: StringField, Sortable: true, Searchable: true},
+			"parent_id":   {Column: "categories.parent_id", Type: NumberField},
+			"depth":       {Column: "categories.depth", Type: NumberField, Sortable: true},
+		}),
+	},
+	"User": {
+		Table: "users",
+		Fields: withFields(baseFields("users"), map[string]QueryField{
+			"username":          {Column: "users.username", Type: StringField, Sortable: true, Searchable: true},
+			"email":             {Column: "users.email", Type: StringField, Sortable: true, Searchable: true},
+			"code":              {Column: "users.code", Type: StringField, Sortable: true, Searchable: true},
+			"role":              {Column: "users.role", Type: StringField, Sortable: true},
+			"active":            {Column: "users.active", Type: BoolField},
+			"email_verified_at": {Column: "users.email_verified_at", Type: TimeField, Sortable: true, Nullable: true},
+		}),
+	},
+	"Purchase": {
+		Table: "purchases",
+		Fields: withFields(baseFields("purchases"), map[string]QueryField{
+			"code":           {Column: "purchases.code", Type: StringField, Sortable: true, Searchable: true},
+			"book_id":        {Column: "purchases.book_id", Type: NumberField},
+			"transaction_id": {Column: "purchases.transaction_id", Type: NumberField},
+			"quantity":       {Column: "purchases.quantity", Type: NumberField, Sortable: true},
+			"book_price":     {Column: "purchases.book_price", Type: NumberField, Sortable: true},
+		}),
+	},
+	"Transaction": {
+		Table: "transactions",
+		Fields: withFields(baseFields("transactions"), map[string]QueryField{
+			"code":             {Column: "transactions.code", Type: StringField, Sortable: true, Searchable: true},
+			"status":           {Column: "transactions.status", Type: StringField, Sortable: true},
+			"user_id":          {Column: "transactions.user_id", Type: NumberField},
+			"total_amount":     {Column: "transactions.total_amount", Type: NumberField, Sortable: true},
+			"transaction_time": {Column: "transactions.transaction_time", Type: TimeField, Sortable: true},
+		}),
+	},
+	"Review": {
+		Table: "reviews",
+		Fields: withFields(baseFields("reviews"), map[string]QueryField{
+			"rating":       {Column: "reviews.rating", Type: NumberField, Sortable: true},
+			"user_id":      {Column: "reviews.user_id", Type: NumberField},
+			"book_id":      {Column: "reviews.book_id", Type: NumberField},
+			"title":        {Column: "reviews.title", Type: StringField, Searchable: true},
+			"body":         {Column: "reviews.body", Type: StringField, Searchable: true},
+			"status":       {Column: "reviews.status", Type: StringField},
+			"report_count": {Column: "reviews.report_count", Type: NumberField, Sortable: true},
+		}),
+		SortAliases: map[string]string{
+			"newest":  "-created_at",
+			"oldest":  "created_at",
+			"highest": "-rating,-created_at",
+			"lowest":  "rating,-created_at",
+		},
+	},
+	"StockMovement": {
+		Table: "stock_movements",
+		Fields: withFields(baseFields("stock_movements"), map[string]QueryField{
+			"type":           {Column: "stock_movements.type", Type: StringField},
+			"quantity_delta": {Column: "stock_movements.quantity_delta", Type: NumberField, Sortable: true},
+			"reference":      {Column: "stock_movements.reference", Type: StringField, Searchable: true},
+			"actor_id":       {Column: "stock_movements.actor_id", Type: NumberField},
+			"reason":         {Column: "stock_movements.reason", Type: StringField, Searchable: true},
+		}),
+	},
+}
+
+// SchemaFor returns the query schema of model, a pointer to a model struct.
+func SchemaFor(model interface{}) (QuerySchema, bool) {
+	schema, ok := querySchemas[reflect.TypeOf(model).Elem().Name()]
+	return schema, ok
+}
+
+var filterParam = regexp.MustCompile(`^filter\[([a-z0-9_]+)\](?:\[([a-z_]+)\])?$`)
+
+// operatorTypes lists which field types each operator accepts.
+var operatorTypes = map[string][]FieldType{
+	"eq":       {StringField, NumberField, BoolField, TimeField},
+	"ne":       {StringField, NumberField, BoolField, TimeField},
+	"gt":       {NumberField, TimeField},
+	"gte":      {NumberField, TimeField},
+	"lt":       {NumberField, TimeField},
+	"lte":      {NumberField, TimeField},
+	"in":       {StringField, NumberField},
+	"between":  {NumberField, TimeField},
+	"contains": {StringField},
+	"is_null":  {StringField, NumberField, BoolField, TimeField},
+}
+
+var comparisonSQL = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// FieldNames returns the names of the fields accepted by keep, sorted.
+func (s QuerySchema) FieldNames(keep func(QueryField) bool) []string {
+	var names []string
+	for name, field := range s.Fields {
+		if keep(field) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func operatorNames() []string {
+	names := make([]string, 0, len(operatorTypes))
+	for name := range operatorTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyFilters adds every filter[field][op]=value parameter of params to
+// query. filter[field]=value is short for filter[field][eq]=value.
+func (s QuerySchema) ApplyFilters(query *gorm.DB, params map[string][]string) (*gorm.DB, error) {
+	// Sorted for a deterministic SQL statement.
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		match := filterParam.FindStringSubmatch(key)
+		if match == nil {
+			return nil, &QueryError{Message: fmt.Sprintf("malformed filter parameter %q, expected filter[field][operator]", key)}
+		}
+		name, operator := match[1], match[2]
+		if operator == "" {
+			operator = "eq"
+		}
+
+		field, ok := s.Fields[name]
+		if !ok {
+			return nil, &QueryError{
+				Message: fmt.Sprintf("unknown filter field %q", name),
+				Allowed: s.FieldNames(func(QueryField) bool { return true }),
+			}
+		}
+		types, ok := operatorTypes[operator]
+		if !ok {
+			return nil, &QueryError{Message: fmt.Sprintf("unknown operator %q for field %q", operator, name), Allowed: operatorNames()}
+		}
+		if !containsFieldType(types, field.Type) {
+			return nil, &QueryError{Message: fmt.Sprintf("operator %q cannot be used on field %q", operator, name)}
+		}
+
+		for _, raw := range params[key] {
+			var err error
+			if query, err = applyFilter(query, field, name, operator, raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return query, nil
+}
+
+// FilterScope is ApplyFilters as a gorm scope, for params that were already
+// validated by ApplyFilters or PaginateAndSearch.
+func (s QuerySchema) FilterScope(params map[string][]string) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		if filtered, err := s.ApplyFilters(query, params); err == nil {
+			return filtered
+		}
+		return query
+	}
+}
+
+func containsFieldType(types []FieldType, fieldType FieldType) bool {
+	for _, t := range types {
+		if t == fieldType {
+			return true
+		}
+	}
+	return false
+}
+
+func applyFilter(query *gorm.DB, field QueryField, name, operator, raw string) (*gorm.DB, error) {
+	switch operator {
+	case "is_null":
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, &QueryError{Message: fmt.Sprintf("filter[%s][is_null] expects true or false", name)}
+		}
+		if isNull {
+			return query.Where(field.Column + " IS NULL"), nil
+		}
+		return query.Where(field.Column + " IS NOT NULL"), nil
+
+	case "contains":
+		return query.Where("LOWER("+field.Column+") LIKE ? ESCAPE '\\'", "%"+escapeLike(strings.ToLower(raw))+"%"), nil
+
+	case "in":
+		var values []interface{}
+		for _, part := range strings.Split(raw, ",") {
+			value, err := parseFieldValue(field, name, strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return query.Where(field.Column+" IN (?)", values), nil
+
+	case "between":
+		parts := strings.Split(raw, ",")
+		if len(parts) != 2 {
+			return nil, &QueryError{Message: fmt.Sprintf("filter[%s][between] expects two comma-separated values", name)}
+		}
+		low, err := parseFieldValue(field, name, strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		high, err := parseFieldValue(field, name, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		return query.Where(field.Column+" BETWEEN ? AND ?", low, high), nil
+
+	default:
+		value, err := parseFieldValue(field, name, raw)
+		if err != nil {
+			return nil, err
+		}
+		return query.Where(field.Column+" "+comparisonSQL[operator]+" ?", value), nil
+	}
+}
+
+func parseFieldValue(field QueryField, name, raw string) (interface{}, error) {
+	switch field.Type {
+	case NumberField:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, &QueryError{Message: fmt.Sprintf("field %q expects a number, got %q", name, raw)}
+		}
+		return value, nil
+	case BoolField:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, &QueryError{Message: fmt.Sprintf("field %q expects true or false, got %q", name, raw)}
+		}
+		return value, nil
+	case TimeField:
+		if value, err := time.Parse(time.RFC3339, raw); err == nil {
+			return value, nil
+		}
+		value, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, &QueryError{Message: fmt.Sprintf("field %q expects a date (YYYY-MM-DD or RFC 3339), got %q", name, raw)}
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// SortKey is one column of a sort.
+type SortKey struct {
+	Name     string
+	Column   string
+	Type     FieldType
+	Desc     bool
+	Nullable bool
+}
+
+// SortKeys parses a sort parameter like "-created_at,title" (or a named
+// alias). The table's id is added as the last key so the order is total and
+// pages are stable.
+func (s QuerySchema) SortKeys(value string) ([]SortKey, error) {
+	if alias, ok := s.SortAliases[value]; ok {
+		value = alias
+	}
+
+	var keys []SortKey
+	hasID := false
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		desc := strings.HasPrefix(part, "-")
+		part = strings.TrimPrefix(part, "-")
+
+		field, ok := s.Fields[part]
+		if !ok || !field.Sortable {
+			allowed := s.FieldNames(func(f QueryField) bool { return f.Sortable })
+			for alias := range s.SortAliases {
+				allowed = append(allowed, alias)
+			}
+			sort.Strings(allowed)
+			return nil, &QueryError{Message: fmt.Sprintf("cannot sort by %q", part), Allowed: allowed}
+		}
+		if part == "id" {
+			hasID = true
+		}
+		keys = append(keys, SortKey{Name: part, Column: field.Column, Type: field.Type, Desc: desc, Nullable: field.Nullable})
+		if hasID {
+			// Nothing after the unique id can change the order.
+			break
+		}
+	}
+	if len(keys) > 0 && !hasID {
+		keys = append(keys, SortKey{Name: "id", Column: s.Table + ".id", Type: NumberField})
+	}
+	return keys, nil
+}
+
+// OrderClause turns a sort parameter into an ORDER BY clause, see SortKeys.
+func (s QuerySchema) OrderClause(value string) (string, error) {
+	keys, err := s.SortKeys(value)
+	if err != nil {
+		return "", err
+	}
+	return orderClause(keys, false), nil
+}
+
+// orderClause renders keys as ORDER BY, with every direction flipped when
+// reverse is set. NULLs of nullable keys come last in either direction, so
+// they come first when reversed.
+func orderClause(keys []SortKey, reverse bool) string {
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		direction := "ASC"
+		if key.Desc != reverse {
+			direction = "DESC"
+		}
+		clause := key.Column + " " + direction
+		if key.Nullable {
+			if reverse {
+				clause += " NULLS FIRST"
+			} else {
+				clause += " NULLS LAST"
+			}
+		}
+		clauses = append(clauses, clause)
+	}
+	return strings.Join(clauses, ", ")
+}
+
+// SearchCondition builds the LIKE condition for search over search_fields.
+func (s QuerySchema) SearchCondition(search string, fields []string, operator string) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for _, name := range fields {
+		name = strings.TrimSpace(name)
+		field, ok := s.Fields[name]
+		if !ok || !field.Searchable {
+			return "", nil, &QueryError{
+				Message: fmt.Sprintf("cannot search on field %q", name),
+				Allowed: s.FieldNames(func(f QueryField) bool { return f.Searchable }),
+			}
+		}
+		conditions = append(conditions, "LOWER("+field.Column+") LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(strings.ToLower(search))+"%")
+	}
+	return strings.Join(conditions, " "+operator+" "), args, nil
+}
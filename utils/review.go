@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"shop-account/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+// HasPurchasedBook reports whether userID has a completed transaction that
+// contains bookID; only such users may review the book.
+func HasPurchasedBook(db *gorm.DB, userID, bookID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Purchase{}).
+		Joins("JOIN transactions ON transactions.id = purchases.transaction_id AND transactions.deleted_at IS NULL").
+		Where("transactions.user_id = ? AND transactions.status = ? AND purchases.book_id = ?", userID, models.Completed, bookID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// AdjustBookRating updates the rating aggregates of a book after one review
+// changed: removed is the rating that no longer counts and added the one that
+// now does, 0 meaning none (e.g. 0, 4 for a new 4-star review; 4, 2 when it is
+// edited; 2, 0 when it is deleted). The update is a single statement on the
+// book row, so concurrent reviews do not lose each other's changes.
+func AdjustBookRating(tx *gorm.DB, bookID uint, removed, added int) error {
+	if removed == added {
+		return nil
+	}
+	countDelta := 0
+	if removed > 0 {
+		countDelta--
+	}
+	if added > 0 {
+		countDelta++
+	}
+	return tx.Model(&models.Book{}).Where("id = ?", bookID).UpdateColumns(map[string]interface{}{
+		"average_rating": gorm.Expr("CASE WHEN review_count + ? <= 0 THEN 0 ELSE (average_rating * review_count - ? + ?) / (review_count + ?) END", countDelta, removed, added, countDelta),
+		"review_count":   gorm.Expr("GREATEST(review_count + ?, 0)", countDelta),
+	}).Error
+}
+
+// ReviewModerationRules decide whether a new or edited review is published
+// right away or waits in the moderation queue. They are read from:
+//
+//	REVIEW_REQUIRE_APPROVAL=true        hold every review for a moderator
+//	REVIEW_BANNED_WORDS=word,two words  hold reviews containing any of them
+//	REVIEW_MIN_ACCOUNT_AGE_HOURS=24     hold reviews from newer accounts
+//	REVIEW_REPORT_THRESHOLD=3           reports that send a review back to the queue
+type ReviewModerationRules struct {
+	RequireApproval bool
+	BannedWords     []string
+	MinAccountAge   time.Duration
+	ReportThreshold uint
+}
+
+// LoadReviewModerationRules reads the rules from the environment.
+func LoadReviewModerationRules() ReviewModerationRules {
+	rules := ReviewModerationRules{
+		RequireApproval: os.Getenv("REVIEW_REQUIRE_APPROVAL") == "true",
+		MinAccountAge:   24 * time.Hour,
+		ReportThreshold: 3,
+	}
+	for _, word := range strings.Split(os.Getenv("REVIEW_BANNED_WORDS"), ",") {
+		if word = normalizeReviewText(word); word != "" {
+			rules.BannedWords = append(rules.BannedWords, word)
+		}
+	}
+	if hours, err := strconv.Atoi(os.Getenv("REVIEW_MIN_ACCOUNT_AGE_HOURS")); err == nil && hours >= 0 {
+		rules.MinAccountAge = time.Duration(hours) * time.Hour
+	}
+	if threshold, err := strconv.Atoi(os.Getenv("REVIEW_REPORT_THRESHOLD")); err == nil && threshold > 0 {
+		rules.ReportThreshold = uint(threshold)
+	}
+	return rules
+}
+
+// normalizeReviewText lowercases text and reduces it to its words separated
+// by single spaces, so banned words match whole words only.
+func normalizeReviewText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// Screen returns the status a review by author should get and, when it is
+// held back, the reason.
+func (rules ReviewModerationRules) Screen(author models.User, review models.Review, now time.Time) (models.ReviewStatus, string) {
+	text := " " + normalizeReviewText(review.Title+" "+review.Body) + " "
+	for _, word := range rules.BannedWords {
+		if strings.Contains(text, " "+word+" ") {
+			return models.ReviewPending, "contains a banned word"
+		}
+	}
+	if now.Sub(author.CreatedAt) < rules.MinAccountAge {
+		return models.ReviewPending, "account is newer than " + rules.MinAccountAge.String()
+	}
+	if rules.RequireApproval {
+		return models.ReviewPending, "all reviews require approval"
+	}
+	return models.ReviewApproved, ""
+}
+
+// ChangeReviewStatus moves review to status, updates the rating of its book
+// and records the change in the moderation log. It must run inside a
+// database transaction, with the review row locked.
+func ChangeReviewStatus(tx *gorm.DB, review *models.Review, status models.ReviewStatus, actorID uint, actorUsername, reason string) error {
+	if !status.IsValid() {
+		return fmt.Errorf("invalid review status %q", status)
+	}
+	previous := *review
+	if previous.Status == status {
+		return nil
+	}
+
+	review.Status = status
+	if err := tx.Model(review).UpdateColumn("status", status).Error; err != nil {
+		return err
+	}
+	if err := AdjustBookRating(tx, review.BookID, previous.CountedRating(), review.CountedRating()); err != nil {
+		return err
+	}
+	return tx.Create(&models.ReviewModerationLog{
+		ReviewID:      review.ID,
+		FromStatus:    previous.Status,
+		ToStatus:      status,
+		ActorID:       actorID,
+		ActorUsername: actorUsername,
+		Reason:        reason,
+	}).Error
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// searchConfig is a text search configuration that strips diacritics before
+// indexing, so "sach" finds "sách" and "dao" finds "đạo".
+const searchConfig = "vn_unaccent"
+
+// bookSearchSetup creates the full-text search objects for books:
+//   - the unaccent and pg_trgm extensions and the vn_unaccent configuration
+//   - books.search_vector, built from title (A), the names of every
+//     contributor and category (B) and description (C), with triggers
+//     keeping it current
+//   - trigram indexes used for typo-tolerant matching and suggestions
+var bookSearchSetup = []string{
+	`CREATE EXTENSION IF NOT EXISTS unaccent`,
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'vn_unaccent') THEN
+			CREATE TEXT SEARCH CONFIGURATION vn_unaccent (COPY = simple);
+			ALTER TEXT SEARCH CONFIGURATION vn_unaccent
+				ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+		END IF;
+	END $$`,
+	// unaccent() is only STABLE; this wrapper can be used in indexes.
+	`CREATE OR REPLACE FUNCTION f_unaccent(text) RETURNS text
+		LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+		AS $$ SELECT public.unaccent('public.unaccent', $1) $$`,
+	`ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`CREATE OR REPLACE FUNCTION book_search_vector(p_book_id bigint, p_title text, p_description text, p_author_id bigint)
+		RETURNS tsvector LANGUAGE sql STABLE AS $$
+		SELECT setweight(to_tsvector('vn_unaccent', coalesce(p_title, '')), 'A')
+			|| setweight(to_tsvector('vn_unaccent', coalesce((
+				SELECT string_agg(name, ' ') FROM authors
+				WHERE id = p_author_id OR id IN (SELECT author_id FROM book_contributors WHERE book_id = p_book_id)), '')), 'B')
+			|| setweight(to_tsvector('vn_unaccent', coalesce((
+				SELECT string_agg(categories.name, ' ')
+				FROM book_categories JOIN categories ON categories.id = book_categories.category_id
+				WHERE book_categories.book_id = p_book_id AND categories.deleted_at IS NULL), '')), 'B')
+			|| setweight(to_tsvector('vn_unaccent', coalesce(p_description, '')), 'C')
+	$$`,
+	`CREATE OR REPLACE FUNCTION books_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+	BEGIN
+		NEW.search_vector := book_search_vector(NEW.id, NEW.title, NEW.description, NEW.author_id);
+		RETURN NEW;
+	END $$`,
+	`DROP TRIGGER IF EXISTS books_search_vector_update ON books`,
+	`CREATE TRIGGER books_search_vector_update BEFORE INSERT OR UPDATE OF title, description, author_id ON books
+		FOR EACH ROW EXECUTE PROCEDURE books_search_vector_trigger()`,
+	`CREATE OR REPLACE FUNCTION book_categories_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+	BEGIN
+		IF TG_OP <> 'INSERT' THEN
+			UPDATE books SET search_vector = book_search_vector(id, title, description, author_id) WHERE id = OLD.book_id;
+		END IF;
+		IF TG_OP <> 'DELETE' THEN
+			UPDATE books SET search_vector = book_search_vector(id, title, description, author_id) WHERE id = NEW.book_id;
+		END IF;
+		RETURN NULL;
+	END $$`,
+	`DROP TRIGGER IF EXISTS book_categories_search_vector_update ON book_categories`,
+	`CREATE TRIGGER book_categories_search_vector_update AFTER INSERT OR UPDATE OR DELETE ON book_categories
+		FOR EACH ROW EXECUTE PROCEDURE book_categories_search_vector_trigger()`,
+	`CREATE OR REPLACE FUNCTION book_contributors_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+	BEGIN
+		IF TG_OP <> 'INSERT' THEN
+			UPDATE books SET search_vector = book_search_vector(id, title, description, author_id) WHERE id = OLD.book_id;
+		END IF;
+		IF TG_OP <> 'DELETE' THEN
+			UPDATE books SET search_vector = book_search_vector(id, title, description, author_id) WHERE id = NEW.book_id;
+		END IF;
+		RETURN NULL;
+	END $$`,
+	`DROP TRIGGER IF EXISTS book_contributors_search_vector_update ON book_contributors`,
+	`CREATE TRIGGER book_contributors_search_vector_update AFTER INSERT OR UPDATE OF author_id OR DELETE ON book_contributors
+		FOR EACH ROW EXECUTE PROCEDURE book_contributors_search_vector_trigger()`,
+	`CREATE OR REPLACE FUNCTION authors_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+	BEGIN
+		UPDATE books SET search_vector = book_search_vector(id, title, description, author_id)
+		WHERE author_id = NEW.id OR id IN (SELECT book_id FROM book_contributors WHERE author_id = NEW.id);
+		RETURN NULL;
+	END $$`,
+	`DROP TRIGGER IF EXISTS authors_search_vector_update ON authors`,
+	`CREATE TRIGGER authors_search_vector_update AFTER UPDATE OF name ON authors
+		FOR EACH ROW EXECUTE PROCEDURE authors_search_vector_trigger()`,
+	`CREATE OR REPLACE FUNCTION categories_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+	BEGIN
+		UPDATE books SET search_vector = book_search_vector(id, title, description, author_id)
+		WHERE id IN (SELECT book_id FROM book_categories WHERE category_id = NEW.id);
+		RETURN NULL;
+	END $$`,
+	`DROP TRIGGER IF EXISTS categories_search_vector_update ON categories`,
+	`CREATE TRIGGER categories_search_vector_update AFTER UPDATE OF name, deleted_at ON categories
+		FOR EACH ROW EXECUTE PROCEDURE categories_search_vector_trigger()`,
+	`UPDATE books SET search_vector = book_search_vector(id, title, description, author_id) WHERE search_vector IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING gin (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_books_title_trgm ON books USING gin (f_unaccent(lower(title)) gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_authors_name_trgm ON authors USING gin (f_unaccent(lower(name)) gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING gin (f_unaccent(lower(name)) gin_trgm_ops)`,
+}
+
+// SetupBookSearch creates or updates the database objects used by
+// SearchBooks. It is safe to run at every startup.
+func SetupBookSearch(db *gorm.DB) error {
+	for _, statement := range bookSearchSetup {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BookSearchHit is one matching book with its relevance and highlights.
+type BookSearchHit struct {
+	BookID         uint    `gorm:"column:id"`
+	Rank           float64 `gorm:"column:rank"`
+	TitleHighlight string  `gorm:"column:title_highlight"`
+	Snippet        string  `gorm:"column:snippet"`
+}
+
+const (
+	searchHighlightOptions = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+	searchSnippetOptions   = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" ... \""
+)
+
+// htmlEscapedColumn is the SQL expression of column with HTML special
+// characters escaped. The highlights are rendered as HTML, so the stored text
+// is escaped before ts_headline adds its <mark> tags; & goes first so the
+// other entities are not escaped twice.
+func htmlEscapedColumn(column string) string {
+	expression := column
+	for _, entity := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"'", "&#39;"}} {
+		expression = fmt.Sprintf("replace(%s, '%s', '%s')", expression, strings.ReplaceAll(entity[0], "'", "''"), entity[1])
+	}
+	return expression
+}
+
+// BookSearchScope restricts a books query to the books matching term: its
+// search vector matches, or its title or the name of one of its contributors
+// is close to term (trigram word similarity), which tolerates typos.
+func BookSearchScope(term string) func(*gorm.DB) *gorm.DB {
+	term = strings.TrimSpace(term)
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where(`books.search_vector @@ websearch_to_tsquery('`+searchConfig+`', ?)
+			OR f_unaccent(lower(?)) <% f_unaccent(lower(books.title))
+			OR books.id IN (SELECT book_contributors.book_id FROM book_contributors
+				JOIN authors ON authors.id = book_contributors.author_id
+				WHERE f_unaccent(lower(?)) <% f_unaccent(lower(authors.name)))`,
+			term, term, term)
+	}
+}
+
+// SearchBooks runs a ranked full-text search over books, see BookSearchScope.
+// query is optional and restricts the candidate books, e.g. by filters. Hits
+// are ordered by relevance unless order is given.
+func SearchBooks(db *gorm.DB, query *gorm.DB, term string, order string, limit, offset int) ([]BookSearchHit, int64, error) {
+	term = strings.TrimSpace(term)
+	if query == nil {
+		query = db
+	}
+	if order == "" {
+		order = "rank DESC, books.id"
+	}
+
+	matches := BookSearchScope(term)(query.Table("books").Where("books.deleted_at IS NULL"))
+
+	var total int64
+	if err := matches.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []BookSearchHit
+	err := matches.
+		Select(`books.id,
+			ts_rank_cd(books.search_vector, websearch_to_tsquery('`+searchConfig+`', ?))
+				+ 0.5 * GREATEST(
+					word_similarity(f_unaccent(lower(?)), f_unaccent(lower(books.title))),
+					COALESCE((SELECT MAX(word_similarity(f_unaccent(lower(?)), f_unaccent(lower(authors.name))))
+						FROM book_contributors JOIN authors ON authors.id = book_contributors.author_id
+						WHERE book_contributors.book_id = books.id), 0)) AS rank,
+			ts_headline('`+searchConfig+`', `+htmlEscapedColumn("books.title")+`, websearch_to_tsquery('`+searchConfig+`', ?), '`+searchHighlightOptions+`') AS title_highlight,
+			ts_headline('`+searchConfig+`', `+htmlEscapedColumn("books.description")+`, websearch_to_tsquery('`+searchConfig+`', ?), '`+searchSnippetOptions+`') AS snippet`,
+		term, term, term, term, term).
+		Order(order).
+		Limit(limit).Offset(offset).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return hits, total, nil
+}
+
+// SearchSuggestions returns up to limit book titles, author names and
+// category names that look like term, best match first. They are meant for
+// "did you mean" hints when a search finds little or nothing.
+func SearchSuggestions(db *gorm.DB, term string, limit int) ([]string, error) {
+	term = strings.TrimSpace(term)
+	var suggestions []struct {
+		Term  string
+		Score float64
+	}
+	err := db.Raw(`SELECT term, MAX(score) AS score FROM (
+			SELECT title AS term, word_similarity(f_unaccent(lower(?)), f_unaccent(lower(title))) AS score
+			FROM books WHERE deleted_at IS NULL AND f_unaccent(lower(?)) <% f_unaccent(lower(title))
+			UNION ALL
+			SELECT name, word_similarity(f_unaccent(lower(?)), f_unaccent(lower(name)))
+			FROM authors WHERE deleted_at IS NULL AND f_unaccent(lower(?)) <% f_unaccent(lower(name))
+			UNION ALL
+			SELECT name, word_similarity(f_unaccent(lower(?)), f_unaccent(lower(name)))
+			FROM categories WHERE deleted_at IS NULL AND f_unaccent(lower(?)) <% f_unaccent(lower(name))
+		) candidates
+		WHERE lower(term) <> lower(?)
+		GROUP BY term
+		ORDER BY score DESC, term
+		LIMIT ?`, term, term, term, term, term, term, term, limit).Scan(&suggestions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	terms := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		terms = append(terms, suggestion.Term)
+	}
+	return terms, nil
+}
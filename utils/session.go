@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"shop-account/models"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenRevoked = errors.New("refresh token has been revoked")
+	// ErrRefreshTokenReused means an already rotated refresh token was
+	// presented again, which suggests it was stolen. The whole session is
+	// revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, the session has been revoked")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrUserInactive       = errors.New("user account is not active")
+)
+
+// TokenPair is what a successful login or refresh returns to the client.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	SessionID    string `json:"session_id"`
+}
+
+// RefreshTokenTTL is how long a refresh token stays usable, configured by
+// JWT_REFRESH_TOKEN_TTL (default 30 days).
+func RefreshTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 30 * 24 * time.Hour
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex SHA-256 of an opaque token, which is what gets
+// stored instead of the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokenPair creates a refresh token in familyID and a matching access
+// token for user. mfa tells whether the session passed a second factor.
+func issueTokenPair(tx *gorm.DB, user models.User, familyID string, mfa bool, userAgent, ipAddress string) (TokenPair, *models.RefreshToken, error) {
+	var pair TokenPair
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return pair, nil, err
+	}
+	record := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: HashToken(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+		MFA:       mfa,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return pair, nil, err
+	}
+
+	accessToken, err := Tokens.GenerateToken(jwt.MapClaims{
+		"user_id":  float64(user.ID),
+		"username": user.Username,
+		"role":     user.Role,
+		"ver":      float64(user.TokenVersion),
+		"sid":      familyID,
+		"mfa":      mfa,
+		"typ":      "access",
+	})
+	if err != nil {
+		return pair, nil, err
+	}
+
+	pair = TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(Tokens.AccessTokenTTL.Seconds()),
+		SessionID:    familyID,
+	}
+	return pair, record, nil
+}
+
+// IssueSession starts a new session for user after a successful login.
+func IssueSession(db *gorm.DB, user models.User, mfa bool, userAgent, ipAddress string) (TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pair, _, err := issueTokenPair(db, user, familyID, mfa, userAgent, ipAddress)
+	return pair, err
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair in the
+// same session. The presented token is revoked; presenting it again later is
+// treated as theft and revokes the whole session.
+func RotateRefreshToken(db *gorm.DB, refreshToken string, userAgent, ipAddress string) (TokenPair, error) {
+	var pair TokenPair
+	var reused bool
+	var reusedFamily string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.RefreshToken
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("token_hash = ?", HashToken(refreshToken)).First(&record).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		if record.RevokedAt != nil {
+			if record.ReplacedByID != nil {
+				reused = true
+				reusedFamily = record.FamilyID
+				return ErrRefreshTokenReused
+			}
+			return ErrRefreshTokenRevoked
+		}
+		if time.Now().After(record.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		var user models.User
+		if err := tx.First(&user, record.UserID).Error; err != nil {
+			return ErrRefreshTokenInvalid
+		}
+		if !user.Active {
+			return ErrUserInactive
+		}
+
+		var next *models.RefreshToken
+		var err error
+		pair, next, err = issueTokenPair(tx, user, record.FamilyID, record.MFA, userAgent, ipAddress)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&record).UpdateColumns(map[string]interface{}{
+			"revoked_at":     now,
+			"replaced_by_id": next.ID,
+		}).Error
+	})
+
+	// The reuse revocation has to be committed on its own: the transaction
+	// above is rolled back because it returned an error.
+	if reused {
+		if revokeErr := RevokeSession(db, reusedFamily); revokeErr != nil {
+			return pair, fmt.Errorf("%v (revoking session failed: %v)", err, revokeErr)
+		}
+	}
+	return pair, err
+}
+
+// RevokeSession revokes every live refresh token of a session, which also
+// invalidates the access tokens carrying its session ID.
+func RevokeSession(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		UpdateColumn("revoked_at", time.Now()).Error
+}
+
+// RevokeAllSessions logs a user out everywhere: all refresh tokens are
+// revoked and the token version is bumped so existing access tokens stop
+// working immediately.
+func RevokeAllSessions(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			UpdateColumn("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+	})
+}
+
+// AuthenticateAccessClaims checks validated access token claims against the
+// database: the user must still exist and be active, the token version must
+// be current and the session must not be revoked. The returned user carries
+// the current role, so role changes apply without waiting for the token to
+// expire.
+func AuthenticateAccessClaims(db *gorm.DB, claims jwt.MapClaims) (*models.User, error) {
+	// Other token types (e.g. 2FA challenges) are signed by the same service
+	// but must never be accepted as access tokens. Every issued token has a
+	// typ, so a token without one is refused too.
+	if claims["typ"] != "access" {
+		return nil, errors.New("not an access token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("invalid user ID in token")
+	}
+
+	var user models.User
+	if err := db.First(&user, uint(userID)).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !user.Active {
+		return nil, ErrUserInactive
+	}
+
+	version, _ := claims["ver"].(float64)
+	if uint(version) != user.TokenVersion {
+		return nil, ErrSessionRevoked
+	}
+
+	if sessionID, ok := claims["sid"].(string); ok && sessionID != "" {
+		var live int
+		if err := db.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+			Count(&live).Error; err != nil {
+			return nil, err
+		}
+		if live == 0 {
+			return nil, ErrSessionRevoked
+		}
+	}
+
+	return &user, nil
+}
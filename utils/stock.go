@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"fmt"
+	"shop-account/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// StockError is returned when the conditional stock decrement matched no row,
+// i.e. the book ran out or another buyer got there first.
+type StockError struct {
+	BookID    uint
+	Title     string
+	Available uint
+}
+
+func (e *StockError) Error() string {
+	return fmt.Sprintf("not enough stock available for %q, the quantity that can be chosen is %d", e.Title, e.Available)
+}
+
+// StockMovementRef describes who caused a stock movement and why. It is
+// copied onto the StockMovement ledger entry.
+type StockMovementRef struct {
+	Reference     string
+	ActorID       uint
+	ActorUsername string
+	Reason        string
+}
+
+// recordStockMovement appends a ledger entry for a change that has just been
+// applied to the book row inside tx.
+func recordStockMovement(tx *gorm.DB, bookID uint, movementType models.StockMovementType, delta int, ref StockMovementRef) error {
+	_, err := createStockMovement(tx, bookID, movementType, delta, ref)
+	return err
+}
+
+// createStockMovement is recordStockMovement returning the ledger entry.
+func createStockMovement(tx *gorm.DB, bookID uint, movementType models.StockMovementType, delta int, ref StockMovementRef) (models.StockMovement, error) {
+	var book models.Book
+	if err := tx.Unscoped().Select("id, quantity_in_stock").First(&book, bookID).Error; err != nil {
+		return models.StockMovement{}, err
+	}
+
+	movement := models.StockMovement{
+		BookID:        bookID,
+		Type:          movementType,
+		QuantityDelta: delta,
+		StockAfter:    book.QuantityInStock,
+		Reference:     ref.Reference,
+		ActorID:       ref.ActorID,
+		ActorUsername: ref.ActorUsername,
+		Reason:        ref.Reason,
+	}
+	err := tx.Create(&movement).Error
+	return movement, err
+}
+
+// ReserveStock atomically moves quantity units of a book from stock to sold
+// and records the sale in the ledger. The WHERE clause re-checks the stock
+// inside the UPDATE itself, so concurrent checkouts can never drive
+// quantity_in_stock below zero.
+func ReserveStock(tx *gorm.DB, bookID uint, quantity uint, ref StockMovementRef) error {
+	result := tx.Model(&models.Book{}).
+		Where("id = ? AND active = ? AND quantity_in_stock >= ?", bookID, true, quantity).
+		UpdateColumns(map[string]interface{}{
+			"quantity_in_stock": gorm.Expr("quantity_in_stock - ?", quantity),
+			"quantity_sold":     gorm.Expr("quantity_sold + ?", quantity),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var book models.Book
+		if err := tx.Unscoped().First(&book, bookID).Error; err != nil {
+			return err
+		}
+		if !book.Active || book.DeletedAt != nil {
+			return &StockError{BookID: book.ID, Title: book.Title}
+		}
+		return &StockError{BookID: book.ID, Title: book.Title, Available: book.QuantityInStock}
+	}
+	return recordStockMovement(tx, bookID, models.MovementSale, -int(quantity), ref)
+}
+
+// ReleaseStock is the compensating movement for ReserveStock: it moves
+// quantity units of a book from sold back to stock and records it in the
+// ledger as movementType (a return or a cancellation). Soft-deleted books are
+// restocked too, so restoring them later gives back the right counters.
+func ReleaseStock(tx *gorm.DB, bookID uint, quantity uint, movementType models.StockMovementType, ref StockMovementRef) error {
+	if quantity == 0 {
+		return nil
+	}
+	result := tx.Unscoped().Model(&models.Book{}).
+		Where("id = ? AND quantity_sold >= ?", bookID, quantity).
+		UpdateColumns(map[string]interface{}{
+			"quantity_in_stock": gorm.Expr("quantity_in_stock + ?", quantity),
+			"quantity_sold":     gorm.Expr("quantity_sold - ?", quantity),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("cannot release %d units of book %d: sold count is lower than that", quantity, bookID)
+	}
+	return recordStockMovement(tx, bookID, movementType, int(quantity), ref)
+}
+
+// AdjustStock applies a receipt or manual adjustment of delta units to a
+// book's stock and records it in the ledger, returning the ledger entry (a
+// zero movement when delta is 0). Negative adjustments are refused with a
+// StockError when they would take the stock below zero.
+func AdjustStock(tx *gorm.DB, bookID uint, delta int, movementType models.StockMovementType, ref StockMovementRef) (models.StockMovement, error) {
+	if delta == 0 {
+		return models.StockMovement{}, nil
+	}
+
+	query := tx.Unscoped().Model(&models.Book{}).Where("id = ?", bookID)
+	if delta < 0 {
+		query = query.Where("quantity_in_stock >= ?", -delta)
+	}
+	result := query.UpdateColumn("quantity_in_stock", gorm.Expr("quantity_in_stock + ?", delta))
+	if result.Error != nil {
+		return models.StockMovement{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var book models.Book
+		if err := tx.Unscoped().First(&book, bookID).Error; err != nil {
+			return models.StockMovement{}, err
+		}
+		return models.StockMovement{}, &StockError{BookID: book.ID, Title: book.Title, Available: book.QuantityInStock}
+	}
+	return createStockMovement(tx, bookID, movementType, delta, ref)
+}
+
+// RecordOpeningStock records the current stock of a book as a receipt. It is
+// used right after a book is created, and once for books that predate the
+// ledger, so the ledger sum starts out equal to the stock.
+func RecordOpeningStock(tx *gorm.DB, bookID uint, ref StockMovementRef) error {
+	var book models.Book
+	if err := tx.Unscoped().Select("id, quantity_in_stock").First(&book, bookID).Error; err != nil {
+		return err
+	}
+	if book.QuantityInStock == 0 {
+		return nil
+	}
+	return recordStockMovement(tx, bookID, models.MovementReceipt, int(book.QuantityInStock), ref)
+}
+
+// SetStock adjusts a book's stock to an absolute quantity through the ledger,
+// for the handlers that accept a new QuantityInStock value.
+func SetStock(tx *gorm.DB, bookID uint, quantity uint, ref StockMovementRef) error {
+	var book models.Book
+	if err := tx.Unscoped().Set("gorm:query_option", "FOR UPDATE").First(&book, bookID).Error; err != nil {
+		return err
+	}
+	_, err := AdjustStock(tx, bookID, int(quantity)-int(book.QuantityInStock), models.MovementAdjustment, ref)
+	return err
+}
+
+// ReleaseTransactionStock gives back the stock of every live purchase of a
+// transaction, recording one ledger entry per purchase.
+func ReleaseTransactionStock(tx *gorm.DB, transactionID uint, movementType models.StockMovementType, ref StockMovementRef) error {
+	var purchases []models.Purchase
+	if err := tx.Where("transaction_id = ?", transactionID).Find(&purchases).Error; err != nil {
+		return err
+	}
+	for _, purchase := range purchases {
+		ref.Reference = purchase.Code
+		if err := ReleaseStock(tx, purchase.BookID, purchase.Quantity, movementType, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecalculateTransactionTotal recomputes TotalAmount from the live purchases
+// of a transaction after an order line was changed or removed.
+func RecalculateTransactionTotal(tx *gorm.DB, transactionID uint) error {
+	var total struct {
+		Amount float64
+	}
+	if err := tx.Model(&models.Purchase{}).
+		Select("COALESCE(SUM(quantity * book_price), 0) AS amount").
+		Where("transaction_id = ?", transactionID).
+		Scan(&total).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Transaction{}).Where("id = ?", transactionID).
+		UpdateColumn("total_amount", total.Amount).Error
+}
+
+// ChangeTransactionStatus moves a transaction to next following the transition
+// table, records the change in the status history and, when the order is
+// rejected or cancelled, gives its stock back. It must run inside a database
+// transaction and expects the transaction row to be locked by the caller.
+func ChangeTransactionStatus(tx *gorm.DB, transaction *models.Transaction, next models.TransactionStatus, actorID uint, actorUsername string, reason string) error {
+	fromStatus := transaction.Status
+	if err := transaction.TransitionTo(next); err != nil {
+		return err
+	}
+
+	if err := tx.Model(transaction).UpdateColumn("status", transaction.Status).Error; err != nil {
+		return err
+	}
+
+	if next == models.Rejected || next == models.Cancelled {
+		ref := StockMovementRef{
+			ActorID:       actorID,
+			ActorUsername: actorUsername,
+			Reason:        fmt.Sprintf("transaction %s %s", transaction.Code, next),
+		}
+		if err := ReleaseTransactionStock(tx, transaction.ID, models.MovementCancellation, ref); err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&models.TransactionStatusHistory{
+		TransactionID: transaction.ID,
+		FromStatus:    fromStatus,
+		ToStatus:      transaction.Status,
+		ActorID:       actorID,
+		ActorUsername: actorUsername,
+		Reason:        reason,
+	}).Error
+}
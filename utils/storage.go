@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+// StoredObject is a file kept by a Storage. Key identifies it for Delete; URL
+// is where clients download it.
+type StoredObject struct {
+	Key         string
+	URL         string
+	ContentType string
+	Size        int64
+}
+
+// Storage keeps uploaded files. Implementations are chosen with
+// STORAGE_DRIVER.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) (StoredObject, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Files is the storage configured at startup by InitStorage.
+var Files Storage
+
+// InitStorage builds Files from the environment:
+//
+//	STORAGE_DRIVER      cloudinary, local or memory (default cloudinary)
+//	CLOUDINARY_*        credentials for the cloudinary driver
+//	STORAGE_LOCAL_DIR   directory of the local driver (default ./uploads)
+//	STORAGE_PUBLIC_URL  URL prefix the local driver's files are served under
+//	                    (default /uploads)
+func InitStorage() error {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "cloudinary":
+		cld, err := ConfigureCloudinary()
+		if err != nil {
+			return err
+		}
+		Files = &CloudinaryStorage{Client: cld}
+	case "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		publicURL := os.Getenv("STORAGE_PUBLIC_URL")
+		if publicURL == "" {
+			publicURL = "/uploads"
+		}
+		Files = &LocalStorage{Dir: dir, PublicURL: strings.TrimSuffix(publicURL, "/")}
+	case "memory":
+		Files = &MemoryStorage{}
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+	return nil
+}
+
+// LocalStorageDir returns the directory and URL prefix to serve when the
+// local driver is in use.
+func LocalStorageDir() (dir, publicURL string, ok bool) {
+	local, ok := Files.(*LocalStorage)
+	if !ok {
+		return "", "", false
+	}
+	return local.Dir, local.PublicURL, true
+}
+
+// CloudinaryStorage stores files as Cloudinary assets; the key is the public
+// ID without extension.
+type CloudinaryStorage struct {
+	Client *cloudinary.Cloudinary
+}
+
+func (s *CloudinaryStorage) Put(ctx context.Context, key string, data []byte, contentType string) (StoredObject, error) {
+	overwrite := true
+	result, err := s.Client.Upload.Upload(ctx, bytes.NewReader(data), uploader.UploadParams{
+		PublicID:  strings.TrimSuffix(key, filepath.Ext(key)),
+		Overwrite: &overwrite,
+	})
+	if err != nil {
+		return StoredObject{}, fmt.Errorf("failed to upload image to Cloudinary: %v", err)
+	}
+	if result.Error.Message != "" {
+		return StoredObject{}, fmt.Errorf("failed to upload image to Cloudinary: %s", result.Error.Message)
+	}
+	return StoredObject{Key: key, URL: result.SecureURL, ContentType: contentType, Size: int64(len(data))}, nil
+}
+
+// Get downloads the asset from its delivery URL.
+func (s *CloudinaryStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	asset, err := s.Client.Image(strings.TrimSuffix(key, filepath.Ext(key)))
+	if err != nil {
+		return nil, err
+	}
+	asset.Config.URL.Secure = true
+	url, err := asset.String()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s from Cloudinary: %s", key, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
+
+func (s *CloudinaryStorage) Delete(ctx context.Context, key string) error {
+	result, err := s.Client.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID: strings.TrimSuffix(key, filepath.Ext(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete image from Cloudinary: %v", err)
+	}
+	if result.Error.Message != "" {
+		return fmt.Errorf("failed to delete image from Cloudinary: %s", result.Error.Message)
+	}
+	return nil
+}
+
+// LocalStorage writes files under Dir, for development and single-server
+// deployments. main serves Dir under PublicURL.
+type LocalStorage struct {
+	Dir       string
+	PublicURL string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) (StoredObject, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return StoredObject{}, err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return StoredObject{}, err
+	}
+	return StoredObject{Key: key, URL: s.PublicURL + "/" + key, ContentType: contentType, Size: int64(len(data))}, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// MemoryStorage keeps files in memory, for tests and local runs without a
+// storage backend. Objects are lost on restart.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string]StoredObject
+	data    map[string][]byte
+}
+
+func (s *MemoryStorage) Put(ctx context.Context, key string, data []byte, contentType string) (StoredObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.objects == nil {
+		s.objects = map[string]StoredObject{}
+		s.data = map[string][]byte{}
+	}
+	object := StoredObject{Key: key, URL: "memory://" + key, ContentType: contentType, Size: int64(len(data))}
+	s.objects[key] = object
+	s.data[key] = append([]byte(nil), data...)
+	return object, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	delete(s.data, key)
+	return nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[key]
+	if !ok {
+		return nil, fmt.Errorf("stored object %s not found", key)
+	}
+	return data, nil
+}
+
+// Keys returns the keys of all stored objects.
+func (s *MemoryStorage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// readAll reads r into memory, failing when it holds more than limit bytes.
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &ImageError{Message: fmt.Sprintf("image is larger than %d bytes", limit)}
+	}
+	return data, nil
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"path"
+	"shop-account/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/image/draw"
+)
+
+// ImageVariantSize is a named variant size: images are scaled down to fit in
+// MaxSize x MaxSize, keeping their aspect ratio, and never scaled up.
+type ImageVariantSize struct {
+	Name    string
+	MaxSize int
+}
+
+// ImageVariantSizes are generated for every uploaded category and book image.
+// Variants are encoded as JPEG: the Go standard library and x/image can
+// decode WebP but not encode it, and we keep image processing pure Go.
+var ImageVariantSizes = []ImageVariantSize{
+	{Name: "thumbnail", MaxSize: 150},
+	{Name: "medium", MaxSize: 600},
+	{Name: "large", MaxSize: 1200},
+}
+
+const variantJPEGQuality = 85
+
+// imageJob asks the worker to generate the missing variants of the image
+// stored under SourceKey. Data is the original content when the caller has it
+// at hand; otherwise it is read back from storage.
+type imageJob struct {
+	SourceKey string
+	Data      []byte
+}
+
+// imageRetryDelay is how long an image whose variants failed to generate is
+// left alone before a request may queue it again.
+const imageRetryDelay = 10 * time.Minute
+
+var (
+	imageJobs     chan imageJob
+	imageJobsMu   sync.Mutex
+	imageInFlight = map[string]bool{}
+	imageFailedAt = map[string]time.Time{}
+)
+
+// StartImageWorkers starts the background workers that generate image
+// variants.
+func StartImageWorkers(db *gorm.DB, workers int) {
+	imageJobs = make(chan imageJob, 256)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range imageJobs {
+				err := GenerateImageVariants(db, job.SourceKey, job.Data)
+				if err != nil {
+					fmt.Printf("Failed to generate variants of %s: %v\n", job.SourceKey, err)
+				}
+				imageJobsMu.Lock()
+				delete(imageInFlight, job.SourceKey)
+				if err != nil {
+					imageFailedAt[job.SourceKey] = time.Now()
+				} else {
+					delete(imageFailedAt, job.SourceKey)
+				}
+				imageJobsMu.Unlock()
+			}
+		}()
+	}
+}
+
+// EnqueueImageVariants schedules variant generation for a stored image. It
+// never blocks: when the queue is full the job is dropped, and the variants
+// are generated later when the image is next requested.
+func EnqueueImageVariants(sourceKey string, data []byte) {
+	if sourceKey == "" || imageJobs == nil {
+		return
+	}
+	imageJobsMu.Lock()
+	defer imageJobsMu.Unlock()
+	if imageInFlight[sourceKey] {
+		return
+	}
+	// Uploads (with data) are always queued; regeneration on read waits
+	// after a failure.
+	if failedAt, failed := imageFailedAt[sourceKey]; failed && data == nil && time.Since(failedAt) < imageRetryDelay {
+		return
+	}
+	select {
+	case imageJobs <- imageJob{SourceKey: sourceKey, Data: data}:
+		imageInFlight[sourceKey] = true
+	default:
+		fmt.Printf("Image variant queue is full, skipping %s\n", sourceKey)
+	}
+}
+
+// variantKey is where the named variant of sourceKey is stored, e.g.
+// books/12/ab12.png -> books/12/ab12_thumbnail.jpg.
+func variantKey(sourceKey, name string) string {
+	return strings.TrimSuffix(sourceKey, path.Ext(sourceKey)) + "_" + name + ".jpg"
+}
+
+// resizeToFit scales src down to fit in maxSize x maxSize.
+func resizeToFit(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		width, height = max(width, 1), max(height, 1)
+	} else if width >= height {
+		width, height = maxSize, max(height*maxSize/width, 1)
+	} else {
+		width, height = max(width*maxSize/height, 1), maxSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	// JPEG has no transparency; paint transparent areas white.
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+// GenerateImageVariants creates the variants of sourceKey that do not exist
+// yet. data may be nil, in which case the original is read from storage.
+func GenerateImageVariants(db *gorm.DB, sourceKey string, data []byte) error {
+	var existing []models.ImageVariant
+	if err := db.Where("source_key = ?", sourceKey).Find(&existing).Error; err != nil {
+		return err
+	}
+	done := map[string]bool{}
+	for _, variant := range existing {
+		done[variant.Name] = true
+	}
+
+	var src image.Image
+	for _, size := range ImageVariantSizes {
+		if done[size.Name] {
+			continue
+		}
+		if src == nil {
+			if data == nil {
+				var err error
+				if data, err = Files.Get(context.Background(), sourceKey); err != nil {
+					return err
+				}
+			}
+			var err error
+			if src, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+				return err
+			}
+		}
+
+		resized := resizeToFit(src, size.MaxSize)
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, resized, &jpeg.Options{Quality: variantJPEGQuality}); err != nil {
+			return err
+		}
+		object, err := Files.Put(context.Background(), variantKey(sourceKey, size.Name), encoded.Bytes(), "image/jpeg")
+		if err != nil {
+			return err
+		}
+
+		variant := models.ImageVariant{
+			SourceKey:  sourceKey,
+			Name:       size.Name,
+			URL:        object.URL,
+			StorageKey: object.Key,
+			Width:      resized.Bounds().Dx(),
+			Height:     resized.Bounds().Dy(),
+		}
+		if err := db.Where(models.ImageVariant{SourceKey: sourceKey, Name: size.Name}).
+			Assign(variant).FirstOrCreate(&variant).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadResponsiveImages returns the responsive image of each source key in
+// sources (storage key -> original URL), reading all variants in one query.
+// Images with missing variants are queued for regeneration; until then the
+// missing names point at the original.
+func LoadResponsiveImages(db *gorm.DB, sources map[string]string) (map[string]*models.ResponsiveImage, error) {
+	images := make(map[string]*models.ResponsiveImage, len(sources))
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return images, nil
+	}
+
+	var variants []models.ImageVariant
+	if err := db.Where("source_key IN (?)", keys).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	bySource := map[string]map[string]models.ImageVariant{}
+	for _, variant := range variants {
+		if bySource[variant.SourceKey] == nil {
+			bySource[variant.SourceKey] = map[string]models.ImageVariant{}
+		}
+		bySource[variant.SourceKey][variant.Name] = variant
+	}
+
+	for _, key := range keys {
+		responsive := &models.ResponsiveImage{Variants: map[string]string{"original": sources[key]}}
+		var srcset []models.ImageVariant
+		for _, size := range ImageVariantSizes {
+			variant, ok := bySource[key][size.Name]
+			if !ok {
+				responsive.Variants[size.Name] = sources[key]
+				continue
+			}
+			responsive.Variants[size.Name] = variant.URL
+			srcset = append(srcset, variant)
+		}
+		if len(srcset) < len(ImageVariantSizes) {
+			EnqueueImageVariants(key, nil)
+		}
+
+		sort.Slice(srcset, func(i, j int) bool { return srcset[i].Width < srcset[j].Width })
+		parts := make([]string, 0, len(srcset))
+		for _, variant := range srcset {
+			parts = append(parts, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+		}
+		responsive.Srcset = strings.Join(parts, ", ")
+		images[key] = responsive
+	}
+	return images, nil
+}
+
+// DeleteStoredImages removes stored images together with their variants. Like
+// DeleteStoredObjects it runs after the database change and only logs errors.
+func DeleteStoredImages(db *gorm.DB, keys ...string) {
+	var sourceKeys []string
+	for _, key := range keys {
+		if key != "" {
+			sourceKeys = append(sourceKeys, key)
+		}
+	}
+	if len(sourceKeys) == 0 {
+		return
+	}
+
+	var variants []models.ImageVariant
+	if err := db.Where("source_key IN (?)", sourceKeys).Find(&variants).Error; err != nil {
+		fmt.Printf("Failed to load image variants: %v\n", err)
+	}
+	for _, variant := range variants {
+		DeleteStoredObjects(variant.StorageKey)
+	}
+	if err := db.Unscoped().Where("source_key IN (?)", sourceKeys).Delete(&models.ImageVariant{}).Error; err != nil {
+		fmt.Printf("Failed to delete image variants: %v\n", err)
+	}
+	DeleteStoredObjects(sourceKeys...)
+}
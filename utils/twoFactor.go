@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"shop-account/models"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+	// A challenge is void after maxChallengeAttempts wrong codes, and a user
+	// cannot get or answer challenges, nor pass any other two-factor check,
+	// once they sent maxTwoFactorFailures wrong codes within twoFactorLockout.
+	maxChallengeAttempts = 5
+	maxTwoFactorFailures = 10
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidSecondFactor = errors.New("invalid two-factor code")
+	ErrInvalidChallenge    = errors.New("invalid or expired challenge token")
+	ErrTwoFactorLocked     = errors.New("too many failed two-factor attempts, try again later")
+)
+
+// TwoFactorIssuer is the issuer name shown in authenticator apps.
+func TwoFactorIssuer() string {
+	if issuer := os.Getenv("TWO_FACTOR_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Book Store"
+}
+
+// TwoFactorRequiredFor reports whether user must use 2FA, either because an
+// admin required it for the account or because their role is listed in
+// TWO_FACTOR_REQUIRED_ROLES.
+func TwoFactorRequiredFor(user *models.User) bool {
+	if user.TwoFactorRequired {
+		return true
+	}
+	for _, role := range strings.Split(os.Getenv("TWO_FACTOR_REQUIRED_ROLES"), ",") {
+		if strings.TrimSpace(role) != "" && strings.TrimSpace(role) == user.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// IssueTwoFactorChallenge returns the short-lived token a client must send
+// back with a TOTP or recovery code to finish a login. Its jti is a
+// single-use UserToken, which also voids the user's earlier challenges.
+func IssueTwoFactorChallenge(db *gorm.DB, user models.User) (string, int64, error) {
+	locked, err := twoFactorLocked(db, user.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	if locked {
+		return "", 0, ErrTwoFactorLocked
+	}
+
+	challengeID, err := IssueUserToken(db, user.ID, models.TwoFactorChallenge, twoFactorChallengeTTL)
+	if err != nil {
+		return "", 0, err
+	}
+	token, err := Tokens.GenerateTokenWithTTL(jwt.MapClaims{
+		"user_id": float64(user.ID),
+		"ver":     float64(user.TokenVersion),
+		"typ":     "2fa_challenge",
+		"jti":     challengeID,
+	}, twoFactorChallengeTTL)
+	return token, int64(twoFactorChallengeTTL.Seconds()), err
+}
+
+// ParseTwoFactorChallenge validates a challenge token and returns its user
+// and the ID of the challenge for CompleteTwoFactorChallenge.
+func ParseTwoFactorChallenge(db *gorm.DB, challenge string) (models.User, string, error) {
+	var user models.User
+	claims, err := Tokens.ParseToken(challenge)
+	if err != nil || claims["typ"] != "2fa_challenge" {
+		return user, "", ErrInvalidChallenge
+	}
+	challengeID, _ := claims["jti"].(string)
+	userID, _ := claims["user_id"].(float64)
+	if challengeID == "" {
+		return user, "", ErrInvalidChallenge
+	}
+	if err := db.First(&user, uint(userID)).Error; err != nil {
+		return user, "", ErrInvalidChallenge
+	}
+	version, _ := claims["ver"].(float64)
+	if !user.Active || !user.TwoFactorEnabled || uint(version) != user.TokenVersion {
+		return user, "", ErrInvalidChallenge
+	}
+	return user, challengeID, nil
+}
+
+// CompleteTwoFactorChallenge checks the second factor sent with a challenge
+// and consumes the challenge on success. A wrong code is counted and the
+// count is committed even though the check fails; the challenge is void
+// after maxChallengeAttempts misses.
+func CompleteTwoFactorChallenge(db *gorm.DB, challengeID string, user *models.User, code, recoveryCode string) error {
+	var verifyErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var challenge models.UserToken
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("token_hash = ? AND purpose = ? AND user_id = ?", HashToken(challengeID), models.TwoFactorChallenge, user.ID).
+			First(&challenge).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrInvalidChallenge
+		}
+		if err != nil {
+			return err
+		}
+		if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+			return ErrInvalidChallenge
+		}
+		locked, err := twoFactorLocked(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return ErrTwoFactorLocked
+		}
+
+		now := time.Now()
+		verifyErr = VerifySecondFactor(tx, user, code, recoveryCode)
+		if verifyErr == nil {
+			return tx.Model(&challenge).UpdateColumn("used_at", now).Error
+		}
+		if verifyErr != ErrInvalidSecondFactor {
+			return verifyErr
+		}
+		updates := map[string]interface{}{"failed_attempts": gorm.Expr("failed_attempts + 1")}
+		if challenge.FailedAttempts+1 >= maxChallengeAttempts {
+			updates["used_at"] = now
+		}
+		if err := tx.Model(&challenge).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		return recordTwoFactorFailure(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// WithSecondFactor checks the second factor of a signed-in user and runs fn
+// in the same transaction when it is valid. Like CompleteTwoFactorChallenge,
+// it refuses locked-out users and commits a record of every wrong code, so a
+// stolen session cannot brute-force the code.
+func WithSecondFactor(db *gorm.DB, user *models.User, code, recoveryCode string, fn func(tx *gorm.DB) error) error {
+	var verifyErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		locked, err := twoFactorLocked(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return ErrTwoFactorLocked
+		}
+
+		verifyErr = VerifySecondFactor(tx, user, code, recoveryCode)
+		if verifyErr == nil {
+			return fn(tx)
+		}
+		if verifyErr != ErrInvalidSecondFactor {
+			return verifyErr
+		}
+		return recordTwoFactorFailure(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// recordTwoFactorFailure counts a wrong code towards the user's lockout.
+func recordTwoFactorFailure(tx *gorm.DB, userID uint) error {
+	return tx.Create(&models.TwoFactorFailure{UserID: userID}).Error
+}
+
+// twoFactorLocked reports whether the user sent too many wrong codes lately.
+func twoFactorLocked(db *gorm.DB, userID uint) (bool, error) {
+	var failures int
+	err := db.Model(&models.TwoFactorFailure{}).
+		Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-twoFactorLockout)).
+		Count(&failures).Error
+	return failures >= maxTwoFactorFailures, err
+}
+
+// VerifyTOTPForUser checks a TOTP code against the user's secret and records
+// the matched time step, refusing codes that were already used. It must run
+// inside a database transaction.
+func VerifyTOTPForUser(tx *gorm.DB, user *models.User, code string) error {
+	// Lock the user so two requests cannot both use the same code.
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(user, user.ID).Error; err != nil {
+		return err
+	}
+	step, ok := ValidateTOTP(user.TwoFactorSecret, code, time.Now())
+	if !ok || step <= user.LastTOTPStep {
+		return ErrInvalidSecondFactor
+	}
+	user.LastTOTPStep = step
+	return tx.Model(user).UpdateColumn("last_totp_step", step).Error
+}
+
+// VerifySecondFactor accepts either a TOTP code or an unused recovery code.
+func VerifySecondFactor(tx *gorm.DB, user *models.User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return UseRecoveryCode(tx, user.ID, recoveryCode)
+	}
+	return VerifyTOTPForUser(tx, user, code)
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes with a new set and
+// returns the plain codes, which are shown to the user only once.
+func GenerateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(raw[:5] + "-" + raw[5:10])
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: HashToken(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes one recovery code of the user.
+func UseRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(strings.ToLower(strings.TrimSpace(code)))).
+		UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"errors"
+	"shop-account/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrUserTokenInvalid = errors.New("token is invalid or has expired")
+
+// IssueUserToken creates a single-use token for purpose and returns the plain
+// token to be mailed. Earlier unused tokens of the same purpose are voided so
+// only the latest mail works.
+func IssueUserToken(db *gorm.DB, userID uint, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			UpdateColumn("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: HashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return token, err
+}
+
+// ConsumeUserToken marks a token as used and returns it. It fails with
+// ErrUserTokenInvalid if the token is unknown, for another purpose, expired
+// or already used. It must run inside a database transaction.
+func ConsumeUserToken(tx *gorm.DB, token string, purpose models.UserTokenPurpose) (models.UserToken, error) {
+	var record models.UserToken
+	err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("token_hash = ? AND purpose = ?", HashToken(token), purpose).
+		First(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return record, ErrUserTokenInvalid
+	}
+	if err != nil {
+		return record, err
+	}
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return record, ErrUserTokenInvalid
+	}
+
+	now := time.Now()
+	record.UsedAt = &now
+	if err := tx.Model(&record).UpdateColumn("used_at", now).Error; err != nil {
+		return record, err
+	}
+	return record, nil
+}